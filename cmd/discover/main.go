@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"tarbitrage/internal/app/market"
+	"tarbitrage/internal/app/robot"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+)
+
+type RobotConfig struct {
+	Market     string   `toml:"MARKET"`
+	Network    string   `toml:"NETWORK"`
+	RestURL    string   `toml:"REST_URL"`
+	WsURL      string   `toml:"WS_URL"`
+	Anchors    []string `toml:"ANCHORS"`
+	MinVolume  float64  `toml:"MIN_VOLUME"`
+	MarginOnly bool     `toml:"MARGIN_ONLY"`
+}
+
+func readRobotConfig(filename string) (RobotConfig, error) {
+	var conf RobotConfig
+
+	_, err := toml.DecodeFile(filename, &conf)
+	if err != nil {
+		return conf, err
+	}
+
+	return conf, nil
+}
+
+func writeJSON(filename string, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, content, 0644)
+}
+
+func main() {
+
+	rConfig, err := readRobotConfig("./robot_config.toml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	endpoints, err := market.GetEndpoints(rConfig.Market, rConfig.Network, rConfig.RestURL, rConfig.WsURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	logger := logrus.New()
+	public, err := market.NewPublicClient(rConfig.Market, endpoints, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	instruments, err := public.GetSpotInstruments()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	symbols, triangles := robot.DiscoverTriangles(instruments, robot.Discovery{
+		Anchors:    rConfig.Anchors,
+		MinVolume:  rConfig.MinVolume,
+		MarginOnly: rConfig.MarginOnly,
+		Logger:     logger,
+	})
+
+	dir := fmt.Sprintf("./files/%s", strings.ToLower(public.Name()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := writeJSON(dir+"/symbols.json", symbols); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeJSON(dir+"/triangles.json", triangles); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("%d symbols and %d triangles written to %s\n", len(symbols), len(triangles), dir)
+}
@@ -18,21 +18,67 @@ type ServerConfig struct {
 }
 
 type RobotConfig struct {
-	Market string  `toml:"MARKET"`
-	Key    string  `toml:"API_KEY"`
-	Secret string  `toml:"SECRET"`
-	Delta  float64 `toml:"DELTA"`
-	Lot    float64 `toml:"LOT"`
-	Fee    float64 `toml:"FEE"`
+	Market       string   `toml:"MARKET"`
+	Key          string   `toml:"API_KEY"`
+	Secret       string   `toml:"SECRET"`
+	Passphrase   string   `toml:"PASSPHRASE"`
+	Network      string   `toml:"NETWORK"`
+	RestURL      string   `toml:"REST_URL"`
+	WsURL        string   `toml:"WS_URL"`
+	Delta        float64  `toml:"DELTA"`
+	Lot          float64  `toml:"LOT"`
+	Fee          float64  `toml:"FEE"`
+	Paper        bool     `toml:"PAPER"`
+	Balance      float64  `toml:"PAPER_BALANCE"`
+	Discover     bool     `toml:"DISCOVER"`
+	Anchors      []string `toml:"ANCHORS"`
+	MinVolume    float64  `toml:"MIN_VOLUME"`
+	MarginOnly   bool     `toml:"MARGIN_ONLY"`
+	Depth        string   `toml:"DEPTH"`
+	Connections  int      `toml:"CONNECTIONS"`
+	Heartbeat    int      `toml:"HEARTBEAT"`
+	StaleTimeout int      `toml:"STALE_TIMEOUT"`
+	StaleShare   float64  `toml:"STALE_SHARE"`
+	MaxBookAge   int      `toml:"MAX_BOOK_AGE"`
+	MaxBookSkew  int      `toml:"MAX_BOOK_SKEW"`
+	Ledger       string   `toml:"LEDGER"`
+	Unwind       string   `toml:"UNWIND"`
+	FeeRefresh   int      `toml:"FEE_REFRESH"`
+	Housekeeping int      `toml:"HOUSEKEEPING"`
+	TimeSync     int      `toml:"TIME_SYNC"`
+	RecvWindow   int      `toml:"RECV_WINDOW"`
 }
 
 type RequestData struct {
-	Market string  `json:"market"`
-	Key    string  `json:"api_key"`
-	Secret string  `json:"secret"`
-	Delta  float64 `json:"delta"`
-	Lot    float64 `json:"lot"`
-	Fee    float64 `json:"fee"`
+	Market       string   `json:"market"`
+	Key          string   `json:"api_key"`
+	Secret       string   `json:"secret"`
+	Passphrase   string   `json:"passphrase"`
+	Network      string   `json:"network"`
+	RestURL      string   `json:"rest_url"`
+	WsURL        string   `json:"ws_url"`
+	Delta        float64  `json:"delta"`
+	Lot          float64  `json:"lot"`
+	Fee          float64  `json:"fee"`
+	Paper        bool     `json:"paper"`
+	Balance      float64  `json:"paper_balance"`
+	Discover     bool     `json:"discover"`
+	Anchors      []string `json:"anchors"`
+	MinVolume    float64  `json:"min_volume"`
+	MarginOnly   bool     `json:"margin_only"`
+	Depth        string   `json:"depth"`
+	Connections  int      `json:"connections"`
+	Heartbeat    int      `json:"heartbeat"`
+	StaleTimeout int      `json:"stale_timeout"`
+	StaleShare   float64  `json:"stale_share"`
+	MaxBookAge   int      `json:"max_book_age"`
+	MaxBookSkew  int      `json:"max_book_skew"`
+	Ledger       string   `json:"ledger"`
+	Unwind       string   `json:"unwind"`
+	FeeRefresh   int      `json:"fee_refresh"`
+	Housekeeping int      `json:"housekeeping"`
+	TimeSync     int      `json:"time_sync"`
+	RecvWindow   int      `json:"recv_window"`
 }
 
 type Response struct {
@@ -110,12 +156,35 @@ func main() {
 	}
 
 	data := RequestData{
-		Market: rConfig.Market,
-		Key:    rConfig.Key,
-		Secret: rConfig.Secret,
-		Delta:  rConfig.Delta,
-		Lot:    rConfig.Lot,
-		Fee:    rConfig.Fee,
+		Market:       rConfig.Market,
+		Key:          rConfig.Key,
+		Secret:       rConfig.Secret,
+		Passphrase:   rConfig.Passphrase,
+		Network:      rConfig.Network,
+		RestURL:      rConfig.RestURL,
+		WsURL:        rConfig.WsURL,
+		Delta:        rConfig.Delta,
+		Lot:          rConfig.Lot,
+		Fee:          rConfig.Fee,
+		Paper:        rConfig.Paper,
+		Balance:      rConfig.Balance,
+		Discover:     rConfig.Discover,
+		Anchors:      rConfig.Anchors,
+		MinVolume:    rConfig.MinVolume,
+		MarginOnly:   rConfig.MarginOnly,
+		Depth:        rConfig.Depth,
+		Connections:  rConfig.Connections,
+		Heartbeat:    rConfig.Heartbeat,
+		StaleTimeout: rConfig.StaleTimeout,
+		StaleShare:   rConfig.StaleShare,
+		MaxBookAge:   rConfig.MaxBookAge,
+		MaxBookSkew:  rConfig.MaxBookSkew,
+		Ledger:       rConfig.Ledger,
+		Unwind:       rConfig.Unwind,
+		FeeRefresh:   rConfig.FeeRefresh,
+		Housekeeping: rConfig.Housekeeping,
+		TimeSync:     rConfig.TimeSync,
+		RecvWindow:   rConfig.RecvWindow,
 	}
 
 	url := fmt.Sprintf("http://%s:%d/robot", sConfig.Host, sConfig.Port)
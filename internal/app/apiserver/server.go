@@ -3,7 +3,11 @@ package apiserver
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"tarbitrage/internal/app/market"
 	"tarbitrage/internal/app/robot"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -17,12 +21,16 @@ type server struct {
 	bot          *robot.Robot
 	inProcess    bool
 	botIsRunning bool
+	// ledgers are the ledgers the robots have been started with per market,
+	// which may be at a custom path
+	ledgers *sync.Map
 }
 
 func newServer() *server {
 	s := &server{
-		router: mux.NewRouter(),
-		logger: logrus.New(),
+		router:  mux.NewRouter(),
+		logger:  logrus.New(),
+		ledgers: new(sync.Map),
 	}
 
 	s.configureRouter()
@@ -38,16 +46,40 @@ func (s *server) configureRouter() {
 	s.router.HandleFunc("/robot", s.handleStartRobot()).Methods("POST")
 	s.router.HandleFunc("/robot", s.handleStopRobot()).Methods("DELETE")
 	s.router.HandleFunc("/robot", s.handleUpdateRobot()).Methods("PUT")
+	s.router.HandleFunc("/pnl", s.handlePnL()).Methods("GET")
 }
 
 func (s *server) handleStartRobot() http.HandlerFunc {
 	type request struct {
-		Delta   float64 `json:"delta"`
-		Market  string  `json:"market"`
-		API_KEY string  `json:"api_key"`
-		Secret  string  `json:"secret"`
-		Fee     float64 `json:"fee"`
-		Lot     float64 `json:"lot"`
+		Delta        float64  `json:"delta"`
+		Market       string   `json:"market"`
+		API_KEY      string   `json:"api_key"`
+		Secret       string   `json:"secret"`
+		Passphrase   string   `json:"passphrase"`
+		Network      string   `json:"network"`
+		RestURL      string   `json:"rest_url"`
+		WsURL        string   `json:"ws_url"`
+		Fee          float64  `json:"fee"`
+		Lot          float64  `json:"lot"`
+		Paper        bool     `json:"paper"`
+		Balance      float64  `json:"paper_balance"`
+		Discover     bool     `json:"discover"`
+		Anchors      []string `json:"anchors"`
+		MinVolume    float64  `json:"min_volume"`
+		MarginOnly   bool     `json:"margin_only"`
+		Depth        string   `json:"depth"`
+		Connections  int      `json:"connections"`
+		Heartbeat    int      `json:"heartbeat"`
+		StaleTimeout int      `json:"stale_timeout"`
+		StaleShare   float64  `json:"stale_share"`
+		MaxBookAge   int      `json:"max_book_age"`
+		MaxBookSkew  int      `json:"max_book_skew"`
+		Ledger       string   `json:"ledger"`
+		Unwind       string   `json:"unwind"`
+		FeeRefresh   int      `json:"fee_refresh"`
+		Housekeeping int      `json:"housekeeping"`
+		TimeSync     int      `json:"time_sync"`
+		RecvWindow   int      `json:"recv_window"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -70,12 +102,72 @@ func (s *server) handleStartRobot() http.HandlerFunc {
 			return
 		}
 
-		bot, err := robot.CreateRobot(req.Market, req.API_KEY, req.Secret, req.Delta/100.0, req.Fee, req.Lot, s.logger)
+		endpoints, err := market.GetEndpoints(req.Market, req.Network, req.RestURL, req.WsURL)
+		if err != nil {
+			s.raiseError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		bot, err := robot.CreateRobot(req.Market, endpoints, req.API_KEY, req.Secret, req.Passphrase, req.Delta/100.0, req.Fee, req.Lot,
+			req.Paper, req.Balance, s.logger)
 		if err != nil {
 			s.raiseError(w, http.StatusBadRequest, err)
 			return
 		}
 
+		if req.Depth != "" {
+			bot.Depth = req.Depth
+		}
+
+		if req.Connections > 0 {
+			bot.Connections = req.Connections
+		}
+
+		if req.Heartbeat > 0 {
+			bot.Public.SetHeartbeat(time.Duration(req.Heartbeat) * time.Second)
+		} else if req.Heartbeat < 0 {
+			bot.Public.SetHeartbeat(0)
+		}
+		if req.FeeRefresh > 0 {
+			bot.FeeRefresh = time.Duration(req.FeeRefresh) * time.Minute
+		} else if req.FeeRefresh < 0 {
+			bot.FeeRefresh = 0
+		}
+		if req.Housekeeping > 0 {
+			bot.Housekeeping = time.Duration(req.Housekeeping) * time.Minute
+		} else if req.Housekeeping < 0 {
+			bot.Housekeeping = 0
+		}
+		if req.TimeSync > 0 {
+			bot.TimeSync = time.Duration(req.TimeSync) * time.Minute
+		} else if req.TimeSync < 0 {
+			bot.TimeSync = 0
+		}
+		if req.RecvWindow > 0 {
+			bot.Private.SetRecvWindow(time.Duration(req.RecvWindow) * time.Millisecond)
+		}
+		bot.StaleTimeout = time.Duration(req.StaleTimeout) * time.Second
+		bot.StaleShare = req.StaleShare / 100.0
+		bot.MaxBookAge = time.Duration(req.MaxBookAge) * time.Millisecond
+		bot.MaxBookSkew = time.Duration(req.MaxBookSkew) * time.Millisecond
+
+		if req.Ledger != "" {
+			bot.Ledger = robot.NewLedger(req.Ledger)
+		}
+
+		if bot.Exec.Unwind, err = robot.NewUnwindPolicy(req.Unwind, bot); err != nil {
+			s.raiseError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if req.Discover {
+			bot.Discovery = &robot.Discovery{
+				Anchors:    req.Anchors,
+				MinVolume:  req.MinVolume,
+				MarginOnly: req.MarginOnly,
+			}
+		}
+
 		if err := bot.Start(); err != nil {
 			s.raiseError(w, http.StatusBadRequest, err)
 			return
@@ -83,8 +175,10 @@ func (s *server) handleStartRobot() http.HandlerFunc {
 
 		s.bot = bot
 		s.botIsRunning = true
+		s.ledgers.Store(bot.Public.Name(), bot.Ledger)
 
-		s.logger.Log(logrus.InfoLevel, fmt.Sprintf("Robot started; Exchange: %s; Trading lot: %.2f.", s.bot.Public.Name(), s.bot.Lot))
+		s.logger.Log(logrus.InfoLevel, fmt.Sprintf("Robot started; Exchange: %s; Trading lot: %.2f; Paper: %t.",
+			s.bot.Public.Name(), s.bot.Lot, req.Paper))
 
 		s.respond(w, http.StatusCreated, struct {
 			Status string `json:"status"`
@@ -157,7 +251,8 @@ func (s *server) handleStopRobot() http.HandlerFunc {
 		s.bot.Stop()
 		s.botIsRunning = false
 
-		s.logger.Log(logrus.InfoLevel, fmt.Sprintf("Robot stopped; Exchange: %s.", s.bot.Public.Name()))
+		s.logger.Log(logrus.InfoLevel, fmt.Sprintf("Robot stopped; Exchange: %s; Evaluations skipped on outdated books: %d; Interest paid: %v.",
+			s.bot.Public.Name(), s.bot.SkippedEvaluations(), s.bot.InterestPaid()))
 
 		s.respond(w, http.StatusCreated, struct {
 			Status string `json:"status"`
@@ -167,6 +262,52 @@ func (s *server) handleStopRobot() http.HandlerFunc {
 	}
 }
 
+// handlePnL aggregates the ledger of the running robot, or of the given market
+// at the path its robot has been started with, by day, triangle or exchange. Dates are YYYY-MM-DD in UTC, "to" is inclusive.
+func (s *server) handlePnL() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		var ledger *robot.Ledger
+		if market := strings.ToUpper(query.Get("market")); market != "" {
+			if opened, ok := s.ledgers.Load(market); ok {
+				ledger = opened.(*robot.Ledger)
+			} else {
+				ledger = robot.NewLedger(robot.LedgerPath(market))
+			}
+		} else if s.bot != nil {
+			ledger = s.bot.Ledger
+		} else {
+			s.raiseError(w, http.StatusBadRequest, fmt.Errorf("market is not specified"))
+			return
+		}
+
+		var from, to time.Time
+		var err error
+		if value := query.Get("from"); value != "" {
+			if from, err = time.Parse("2006-01-02", value); err != nil {
+				s.raiseError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if value := query.Get("to"); value != "" {
+			if to, err = time.Parse("2006-01-02", value); err != nil {
+				s.raiseError(w, http.StatusBadRequest, err)
+				return
+			}
+			to = to.AddDate(0, 0, 1)
+		}
+
+		summary, err := ledger.Aggregate(query.Get("group_by"), from, to)
+		if err != nil {
+			s.raiseError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		s.respond(w, http.StatusOK, summary)
+	}
+}
+
 func (s *server) raiseError(w http.ResponseWriter, code int, err error) {
 	s.respond(w, code, map[string]string{"error": err.Error()})
 }
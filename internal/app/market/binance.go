@@ -11,30 +11,34 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"tarbitrage/pkg/decimal"
 	"tarbitrage/pkg/websocket"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-var BinanceHost string = "https://api.binance.com"
-var BinanceBaseWsUrl string = "wss://stream.binance.com:9443/ws"
-
 var BinanceHeaders = map[string]string{
 	"Accept":     "application/json",
 	"User-Agent": "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/56.0.2924.87 Safari/537.36",
 }
 
 type BinancePublicClient struct {
-	name   string
-	Logger *logrus.Logger
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
 }
 
 type BinancePrivateClient struct {
-	name   string
-	Key    string
-	Secret string
-	Logger *logrus.Logger
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Logger     *logrus.Logger
+	Clock      Clock
+	RecvWindow time.Duration
 }
 
 type BinanceSymbol struct {
@@ -44,6 +48,7 @@ type BinanceSymbol struct {
 	Symbol         string
 	BasePrecision  int
 	PricePrecision int
+	Filters        SymbolFilters
 }
 
 var BinanceSides = map[string]string{
@@ -83,10 +88,23 @@ func (s *BinanceSymbol) SetPricePrecision(prec int) {
 	s.PricePrecision = prec
 }
 
+func (s *BinanceSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *BinanceSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
 func (c *BinancePublicClient) Name() string {
 	return c.name
 }
 
+// SetHeartbeat sets the interval of application-level pings, zero disables them.
+func (c *BinancePublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
 func (c *BinancePrivateClient) Name() string {
 	return c.name
 }
@@ -99,6 +117,11 @@ func (c *BinancePrivateClient) GetSecret() string {
 	return c.Secret
 }
 
+// SupportsShort is true, orders borrow on the cross margin account.
+func (c *BinancePrivateClient) SupportsShort() bool {
+	return true
+}
+
 func (c *BinancePublicClient) CreateSymbol(base_symbol string) MarketSymbol {
 	assets := strings.Split(base_symbol, "+")
 	return &BinanceSymbol{
@@ -109,80 +132,125 @@ func (c *BinancePublicClient) CreateSymbol(base_symbol string) MarketSymbol {
 	}
 }
 
-func (c *BinancePublicClient) RunOrderBookStream(symbol MarketSymbol, levels string, handler OrderBookHandler,
+// BinanceMaxStreams is the number of streams a single connection may carry.
+var BinanceMaxStreams = 1024
+
+// RunOrderBookStreams subscribes the symbols over the given number of combined
+// stream connections. 5, 10 or 20 levels select the partial book depth stream;
+// any other number of levels selects the diff depth stream kept in sync with a
+// REST snapshot of that many levels (up to 5000).
+func (c *BinancePublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, BinanceMaxStreams) {
+		books := make([]binanceDepthBook, len(group))
+		for i, symbol := range group {
+			switch levels {
+			case "5", "10", "20":
+				books[i] = &binancePartialBook{
+					symbol:     symbol,
+					levels:     levels,
+					local:      NewLocalOrderBook(),
+					handler:    handler,
+					errHandler: errHandler,
+				}
+			default:
+				books[i] = newBinanceDiffBook(c, symbol, levels, handler, errHandler)
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
+	}
+
+	return streams, nil
+}
+
+type binanceDepthBook interface {
+	stream() string
+	reset()
+	process(data []byte)
+}
+
+func (c *BinancePublicClient) runDepthConnection(id int, books []binanceDepthBook,
 	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
 
-	endpoint := BinanceBaseWsUrl
+	endpoint := c.Endpoints.Ws
 	wsApp := new(websocket.WebSocketApp)
 
-	type event struct {
-		Bids [][]string `json:"bids"`
-		Asks [][]string `json:"asks"`
+	byStream := make(map[string]binanceDepthBook, len(books))
+	params := make([]string, len(books))
+	for idx, book := range books {
+		byStream[book.stream()] = book
+		params[idx] = book.stream()
 	}
+
+	type message struct {
+		Stream string          `json:"stream"`
+		Data   json.RawMessage `json:"data"`
+	}
+
 	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.reset()
+		}
 		subscription := map[string]interface{}{
 			"method": "SUBSCRIBE",
-			"params": []string{
-				fmt.Sprintf("%s@depth%s@100ms", strings.ToLower(symbol.GetSymbol()), levels),
-			},
-			"id": time.Now().UnixMilli(),
+			"params": params,
+			"id":     time.Now().UnixMilli(),
 		}
 		ws.Send(subscription)
-		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s has been started.\n", c.Name(), symbol.GetBaseSymbol()))
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
 	}
-	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
-		e := new(event)
-		err := json.Unmarshal(message, e)
+	wsApp.OnMessage = func(ws *websocket.WebSocketApp, data []byte) {
+		m := new(message)
+		err := json.Unmarshal(data, m)
 
 		if err != nil {
 			errHandler(err)
 			return
 		}
 
-		if len(e.Asks) == 0 {
+		book, ok := byStream[m.Stream]
+		if !ok {
 			return
 		}
 
-		book := new(OrderBookEvent)
-
-		book.Asks = make([]PriceLevel, len(e.Asks))
-		book.Bids = make([]PriceLevel, len(e.Bids))
-
-		for i := 0; i < len(book.Asks); i++ {
-			item := e.Asks[i]
-			price, _ := strconv.ParseFloat(item[0], 64)
-			quantity, _ := strconv.ParseFloat(item[1], 64)
-			book.Asks[i] = PriceLevel{
-				Price:    price,
-				Quantity: quantity,
-			}
-		}
-
-		for i := 0; i < len(book.Bids); i++ {
-			item := e.Bids[i]
-			price, _ := strconv.ParseFloat(item[0], 64)
-			quantity, _ := strconv.ParseFloat(item[1], 64)
-			book.Bids[i] = PriceLevel{
-				Price:    price,
-				Quantity: quantity,
-			}
-		}
-
-		handler(book)
+		book.process(m.Data)
 	}
 	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
 		c.Logger.Log(logrus.InfoLevel, err)
 	}
 	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
-		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s is stopped.\n", c.Name(), symbol.GetBaseSymbol()))
-		if ws.IsRunning {
-			ws.Run(ws.Config.Endpoint, ws.Config.WebsocketKeepalive, ws.Config.Timeout)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
 		}
 	}
 
 	wsApp.OnPing = func(ws *websocket.WebSocketApp, ping []byte) {
 		wsApp.SendPong(ping)
 	}
+	wsApp.Heartbeat = c.Heartbeat
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		request := map[string]interface{}{
+			"method": "LIST_SUBSCRIPTIONS",
+			"id":     time.Now().UnixMilli(),
+		}
+		if err := ws.Send(request); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
+		}
+	}
 
 	if err := wsApp.Run(endpoint, false, 0); err != nil {
 		return nil, err
@@ -191,6 +259,217 @@ func (c *BinancePublicClient) RunOrderBookStream(symbol MarketSymbol, levels str
 	return wsApp, nil
 }
 
+type binancePartialBook struct {
+	symbol     MarketSymbol
+	levels     string
+	local      *LocalOrderBook
+	handler    OrderBookHandler
+	errHandler websocket.ErrHandler
+}
+
+func (b *binancePartialBook) stream() string {
+	return fmt.Sprintf("%s@depth%s@100ms", strings.ToLower(b.symbol.GetSymbol()), b.levels)
+}
+
+func (b *binancePartialBook) reset() {
+	b.local.Reset()
+	b.handler(StaleEvent(b.symbol.GetBaseSymbol()))
+}
+
+func (b *binancePartialBook) process(data []byte) {
+	type event struct {
+		Bids [][]string `json:"bids"`
+		Asks [][]string `json:"asks"`
+	}
+
+	e := new(event)
+	err := json.Unmarshal(data, e)
+
+	if err != nil {
+		b.errHandler(err)
+		return
+	}
+
+	if len(e.Asks) == 0 {
+		return
+	}
+
+	b.local.ApplySnapshot(e.Asks, e.Bids)
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
+// binanceDiffBook follows the documented procedure to manage a local order
+// book: diff events are buffered while the REST snapshot is loading, events
+// older than the snapshot are dropped and any gap between the last applied
+// update id and the first update id of an event triggers a new snapshot.
+// Failed snapshots are retried with the reconnection backoff.
+type binanceDiffBook struct {
+	client     *BinancePublicClient
+	symbol     MarketSymbol
+	limit      int
+	local      *LocalOrderBook
+	lock       sync.Mutex
+	synced     bool
+	syncing    bool
+	failures   int
+	retryAt    time.Time
+	buffer     []*binanceDiffEvent
+	handler    OrderBookHandler
+	errHandler websocket.ErrHandler
+}
+
+type binanceDiffEvent struct {
+	Type  string     `json:"e"`
+	Time  int64      `json:"E"`
+	First int64      `json:"U"`
+	Last  int64      `json:"u"`
+	Bids  [][]string `json:"b"`
+	Asks  [][]string `json:"a"`
+}
+
+func newBinanceDiffBook(client *BinancePublicClient, symbol MarketSymbol, levels string,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) *binanceDiffBook {
+
+	limit, err := strconv.Atoi(levels)
+	if err != nil || limit <= 0 || limit > 5000 {
+		limit = 1000
+	}
+
+	return &binanceDiffBook{
+		client:     client,
+		symbol:     symbol,
+		limit:      limit,
+		local:      NewLocalOrderBook(),
+		buffer:     make([]*binanceDiffEvent, 0),
+		handler:    handler,
+		errHandler: errHandler,
+	}
+}
+
+func (b *binanceDiffBook) stream() string {
+	return fmt.Sprintf("%s@depth@100ms", strings.ToLower(b.symbol.GetSymbol()))
+}
+
+func (b *binanceDiffBook) reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.synced = false
+	b.buffer = make([]*binanceDiffEvent, 0)
+	b.handler(StaleEvent(b.symbol.GetBaseSymbol()))
+}
+
+func (b *binanceDiffBook) apply(e *binanceDiffEvent) bool {
+	if e.Last <= b.local.UpdateID {
+		return true
+	}
+	if e.First > b.local.UpdateID+1 {
+		return false
+	}
+	b.local.ApplyDelta(e.Asks, e.Bids)
+	b.local.UpdateID = e.Last
+	b.local.EventTime = time.UnixMilli(e.Time)
+	return true
+}
+
+func (b *binanceDiffBook) resync() {
+	snapshot, err := b.client.GetDepthSnapshot(b.symbol.GetSymbol(), b.limit)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.syncing = false
+
+	if err != nil {
+		b.failures++
+		b.retryAt = time.Now().Add(websocket.DefaultReconnectPolicy.Delay(b.failures))
+		b.errHandler(err)
+		return
+	}
+	b.failures = 0
+
+	b.local.ApplySnapshot(snapshot.Asks, snapshot.Bids)
+	b.local.UpdateID = snapshot.LastUpdateID
+
+	pending := b.buffer
+	b.buffer = make([]*binanceDiffEvent, 0)
+	for idx, e := range pending {
+		if !b.apply(e) {
+			// the snapshot is older than the buffered events
+			b.buffer = pending[idx:]
+			b.syncing = true
+			go b.resync()
+			return
+		}
+	}
+
+	b.synced = true
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), b.limit))
+}
+
+func (b *binanceDiffBook) process(data []byte) {
+	e := new(binanceDiffEvent)
+	err := json.Unmarshal(data, e)
+
+	if err != nil {
+		b.errHandler(err)
+		return
+	}
+
+	if e.Type != "depthUpdate" {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.synced {
+		b.buffer = append(b.buffer, e)
+		if !b.syncing && !time.Now().Before(b.retryAt) {
+			b.syncing = true
+			go b.resync()
+		}
+		return
+	}
+
+	if !b.apply(e) {
+		b.client.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s: gap in updates (u %d -> U %d), resyncing.\n",
+			b.client.Name(), b.symbol.GetBaseSymbol(), b.local.UpdateID, e.First))
+		b.synced = false
+		b.buffer = append(b.buffer, e)
+		b.syncing = true
+		b.handler(StaleEvent(b.symbol.GetBaseSymbol()))
+		go b.resync()
+		return
+	}
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), b.limit))
+}
+
+type BinanceDepthSnapshot struct {
+	Code         int        `json:"code"`
+	Message      string     `json:"msg"`
+	LastUpdateID int64      `json:"lastUpdateId"`
+	Bids         [][]string `json:"bids"`
+	Asks         [][]string `json:"asks"`
+}
+
+func (c *BinancePublicClient) GetDepthSnapshot(symbol string, limit int) (*BinanceDepthSnapshot, error) {
+	parameters := map[string]interface{}{
+		"symbol": symbol,
+		"limit":  limit,
+	}
+
+	resp := new(BinanceDepthSnapshot)
+	if err := c.Perform(parameters, "api/v3/depth", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	return resp, nil
+}
+
 func (c *BinancePublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
 	keys := make([]string, 0, len(query))
 	for k := range query {
@@ -212,7 +491,7 @@ func (c *BinancePublicClient) Perform(query map[string]interface{}, method strin
 	}
 	queryString := strings.Join(queryStrings, "&")
 
-	url := fmt.Sprintf("%s/%s?%s", BinanceHost, method, queryString)
+	url := fmt.Sprintf("%s/%s?%s", c.Endpoints.Rest, method, queryString)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest(session_method, url, nil)
@@ -259,9 +538,13 @@ func (c *BinancePublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
 	}
 
 	type filter struct {
-		Type     string `json:"filterType"`
-		TickSize string `json:"tickSize"`
-		StepSize string `json:"stepSize"`
+		Type        string `json:"filterType"`
+		TickSize    string `json:"tickSize"`
+		StepSize    string `json:"stepSize"`
+		MinQty      string `json:"minQty"`
+		MaxQty      string `json:"maxQty"`
+		MinNotional string `json:"minNotional"`
+		MaxNotional string `json:"maxNotional"`
 	}
 
 	type SymbolData struct {
@@ -300,19 +583,97 @@ func (c *BinancePublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
 		if !ok {
 			return fmt.Errorf("can't find precision information for symbol %s", s.GetBaseSymbol())
 		}
+		filters := SymbolFilters{}
 		for _, f := range data.Filters {
 			switch f.Type {
 			case "PRICE_FILTER":
 				s.SetPricePrecision(GetPrecision(f.TickSize))
+				filters.TickSize, _ = decimal.Parse(f.TickSize)
 			case "LOT_SIZE":
 				s.SetBasePrecision(GetPrecision(f.StepSize))
+				filters.StepSize, _ = decimal.Parse(f.StepSize)
+				filters.MinQty, _ = decimal.Parse(f.MinQty)
+				filters.MaxQty, _ = decimal.Parse(f.MaxQty)
+			case "MIN_NOTIONAL", "NOTIONAL":
+				filters.MinNotional, _ = decimal.Parse(f.MinNotional)
+				filters.MaxNotional, _ = decimal.Parse(f.MaxNotional)
+			}
+		}
+		// market orders are bounded by MARKET_LOT_SIZE as well
+		for _, f := range data.Filters {
+			if f.Type != "MARKET_LOT_SIZE" {
+				continue
+			}
+			if max, _ := decimal.Parse(f.MaxQty); max.Sign() > 0 && (filters.MaxQty.IsZero() || max.Cmp(filters.MaxQty) < 0) {
+				filters.MaxQty = max
 			}
 		}
+		s.SetFilters(filters)
 	}
 
 	return nil
 }
 
+func (c *BinancePublicClient) GetSpotInstruments() ([]Instrument, error) {
+	type SymbolData struct {
+		Symbol     string `json:"symbol"`
+		Status     string `json:"status"`
+		BaseAsset  string `json:"baseAsset"`
+		QuoteAsset string `json:"quoteAsset"`
+		Spot       bool   `json:"isSpotTradingAllowed"`
+		Margin     bool   `json:"isMarginTradingAllowed"`
+	}
+
+	type response struct {
+		Code    int          `json:"code"`
+		Message string       `json:"msg"`
+		List    []SymbolData `json:"symbols"`
+	}
+
+	resp := new(response)
+	if err := c.Perform(map[string]interface{}{}, "api/v3/exchangeInfo", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	type ticker struct {
+		Symbol      string `json:"symbol"`
+		LastPrice   string `json:"lastPrice"`
+		QuoteVolume string `json:"quoteVolume"`
+	}
+
+	tickers := make([]ticker, 0)
+	if err := c.Perform(map[string]interface{}{}, "api/v3/ticker/24hr", "GET", &tickers); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]ticker, len(tickers))
+	for _, t := range tickers {
+		stats[t.Symbol] = t
+	}
+
+	instruments := make([]Instrument, 0, len(resp.List))
+	for _, data := range resp.List {
+		if data.Status != "TRADING" || !data.Spot {
+			continue
+		}
+		price, _ := strconv.ParseFloat(stats[data.Symbol].LastPrice, 64)
+		volume, _ := strconv.ParseFloat(stats[data.Symbol].QuoteVolume, 64)
+		instruments = append(instruments, Instrument{
+			BaseAsset:   data.BaseAsset,
+			QuoteAsset:  data.QuoteAsset,
+			Margin:      data.Margin,
+			LastPrice:   price,
+			QuoteVolume: volume,
+		})
+	}
+
+	return instruments, nil
+}
+
 func (c *BinancePrivateClient) generateSignature(queryString string) string {
 	h := hmac.New(sha256.New, []byte(c.Secret))
 	h.Write([]byte(queryString))
@@ -339,19 +700,15 @@ func (c *BinancePrivateClient) PerformSign(query map[string]interface{}, method
 			queryStrings = append(queryStrings, fmt.Sprintf("%s=%v", k, v))
 		}
 	}
-	queryString := strings.Join(queryStrings, "&")
-
-	sortedQuery["signature"] = c.generateSignature(queryString)
-
-	queryStrings = make([]string, 0)
-	for k, v := range sortedQuery {
-		queryStrings = append(queryStrings, fmt.Sprintf("%s=%v", k, v))
+	if c.RecvWindow > 0 {
+		queryStrings = append(queryStrings, fmt.Sprintf("recvWindow=%d", c.RecvWindow.Milliseconds()))
 	}
+	queryString := strings.Join(queryStrings, "&")
 
-	payload := strings.Join(queryStrings, "&")
+	// the signature covers the parameters in the order they are sent
+	payload := queryString + "&signature=" + c.generateSignature(queryString)
 
-	url := fmt.Sprintf("%s/%s?%s", BinanceHost, method, payload)
-	BinanceHeaders["X-MBX-APIKEY"] = c.Key
+	url := fmt.Sprintf("%s/%s?%s", c.Endpoints.Rest, method, payload)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest(session_method, url, nil)
@@ -363,6 +720,7 @@ func (c *BinancePrivateClient) PerformSign(query map[string]interface{}, method
 	for key, value := range BinanceHeaders {
 		req.Header.Set(key, value)
 	}
+	req.Header.Set("X-MBX-APIKEY", c.Key)
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -383,6 +741,30 @@ func (c *BinancePrivateClient) PerformSign(query map[string]interface{}, method
 	return nil
 }
 
+// SyncTime measures the offset of the local clock from /api/v3/time.
+func (c *BinancePrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type result struct {
+			ServerTime int64  `json:"serverTime"`
+			Code       int    `json:"code"`
+			Message    string `json:"msg"`
+		}
+
+		resp := new(result)
+		if err := (&BinancePublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "api/v3/time", "GET", resp); err != nil {
+			return 0, err
+		}
+		if resp.Code != 0 {
+			return 0, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+		}
+		return resp.ServerTime, nil
+	})
+}
+
+func (c *BinancePrivateClient) SetRecvWindow(window time.Duration) {
+	c.RecvWindow = window
+}
+
 func (c *BinancePrivateClient) ApplyInitial(lot float64) error {
 	balance, err := c.GetMarginBalance()
 	if err != nil {
@@ -396,7 +778,7 @@ func (c *BinancePrivateClient) ApplyInitial(lot float64) error {
 
 func (c *BinancePrivateClient) GetMarginBalance() (float64, error) {
 	parameters := map[string]interface{}{
-		"timestamp": time.Now().UnixMilli(),
+		"timestamp": c.Clock.Now(),
 	}
 
 	type result struct {
@@ -418,51 +800,250 @@ func (c *BinancePrivateClient) GetMarginBalance() (float64, error) {
 	return available, nil
 }
 
-func (c *BinancePrivateClient) PlaceOrder(symbol, side, t, quantity string) (float64, error) {
+// GetBalances returns the cross margin position of every asset.
+func (c *BinancePrivateClient) GetBalances() (map[string]Balance, error) {
+	parameters := map[string]interface{}{
+		"timestamp": c.Clock.Now(),
+	}
+
+	type asset struct {
+		Asset    string `json:"asset"`
+		Free     string `json:"free"`
+		Locked   string `json:"locked"`
+		Borrowed string `json:"borrowed"`
+		Interest string `json:"interest"`
+	}
+
+	type result struct {
+		Assets  []asset `json:"userAssets"`
+		Code    int     `json:"code"`
+		Message string  `json:"msg"`
+	}
+
+	resp := new(result)
+
+	if err := c.PerformSign(parameters, "/sapi/v1/margin/account", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	balances := make(map[string]Balance, len(resp.Assets))
+	for _, a := range resp.Assets {
+		balance := Balance{Asset: a.Asset}
+		balance.Free, _ = strconv.ParseFloat(a.Free, 64)
+		balance.Locked, _ = strconv.ParseFloat(a.Locked, 64)
+		balance.Borrowed, _ = strconv.ParseFloat(a.Borrowed, 64)
+		balance.Interest, _ = strconv.ParseFloat(a.Interest, 64)
+		balances[a.Asset] = balance
+	}
+
+	return balances, nil
+}
+
+// Repay repays a cross margin loan from the free balance; the interest is
+// repaid first.
+func (c *BinancePrivateClient) Repay(asset string, amount decimal.Decimal) error {
 	parameters := map[string]interface{}{
-		"symbol":           symbol,
+		"asset":      asset,
+		"amount":     amount.String(),
+		"type":       "REPAY",
+		"isIsolated": "FALSE",
+		"timestamp":  c.Clock.Now(),
+	}
+
+	type result struct {
+		TranID  int64  `json:"tranId"`
+		Code    int    `json:"code"`
+		Message string `json:"msg"`
+	}
+
+	resp := new(result)
+
+	if err := c.PerformSign(parameters, "/sapi/v1/margin/borrow-repay", "POST", resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	return nil
+}
+
+// GetFees returns the taker fee in percent per base symbol. The fee is reduced
+// by a quarter when it is paid in BNB.
+func (c *BinancePrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	type burn struct {
+		Code    int    `json:"code"`
+		Message string `json:"msg"`
+		Spot    bool   `json:"spotBNBBurn"`
+	}
+
+	bnb := new(burn)
+	if err := c.PerformSign(map[string]interface{}{"timestamp": c.Clock.Now()}, "/sapi/v1/bnbBurn", "GET", bnb); err != nil {
+		return nil, err
+	}
+	if bnb.Code != 0 {
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", bnb.Code, bnb.Message)
+	}
+
+	discount := 1.0
+	if bnb.Spot {
+		discount = 0.75
+	}
+
+	type fee struct {
+		Symbol string `json:"symbol"`
+		Taker  string `json:"takerCommission"`
+	}
+
+	list := make([]fee, 0)
+	if err := c.PerformSign(map[string]interface{}{"timestamp": c.Clock.Now()}, "/sapi/v1/asset/tradeFee", "GET", &list); err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]float64, len(list))
+	for _, f := range list {
+		rate, _ := strconv.ParseFloat(f.Taker, 64)
+		rates[f.Symbol] = rate * 100 * discount
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		if rate, ok := rates[s.GetSymbol()]; ok {
+			fees[s.GetBaseSymbol()] = rate
+		}
+	}
+
+	return fees, nil
+}
+
+func (c *BinancePrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+	parameters := map[string]interface{}{
+		"symbol":           symbol.GetSymbol(),
 		"side":             BinanceSides[side],
 		"type":             "MARKET",
-		"timestamp":        time.Now().UnixMilli(),
-		"newClientOrderId": strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"timestamp":        c.Clock.Now(),
+		"newClientOrderId": clientID,
+		"newOrderRespType": "FULL",
 		"isIsolated":       "False",
 	}
 
 	switch t {
 	case "open":
-		parameters["quoteOrderQty"] = quantity
+		parameters["quoteOrderQty"] = quantity.String()
 		parameters["sideEffectType"] = "MARGIN_BUY"
 	case "close":
-		parameters["quantity"] = quantity
+		parameters["quantity"] = quantity.String()
 		parameters["sideEffectType"] = "AUTO_REPAY"
 	}
 
-	type Fill struct {
-		Price      string `json:"price"`
-		Quantity   string `json:"qty"`
-		Commission string `json:"commission"`
+	resp := new(binanceOrderResponse)
+
+	if err := c.PerformSign(parameters, "/sapi/v1/margin/order", "POST", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
 	}
 
-	type response struct {
-		Code          int    `json:"code"`
-		Message       string `json:"msg"`
-		Price         string `json:"price"`
-		Quantity      string `json:"executedQty"`
-		Side          string `json:"side"`
-		QuoteQuantity string `json:"cummulativeQuoteQty"`
-		Fills         []Fill `json:"fills"`
+	return resp.result(), nil
+}
+
+// GetOrder looks the order up by client id and sums the commissions of its trades.
+func (c *BinancePrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	parameters := map[string]interface{}{
+		"symbol":            symbol.GetSymbol(),
+		"origClientOrderId": clientID,
+		"isIsolated":        "FALSE",
+		"timestamp":         c.Clock.Now(),
 	}
 
-	resp := new(response)
+	resp := new(binanceOrderResponse)
 
-	if err := c.PerformSign(parameters, "/sapi/v1/margin/order", "POST", resp); err != nil {
-		return 0, err
+	if err := c.PerformSign(parameters, "/sapi/v1/margin/order", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code == -2013 {
+		return nil, ErrOrderNotFound
 	}
 	if resp.Code != 0 {
-		return 0, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
+		return nil, fmt.Errorf("binance error: code: %d, message: %s", resp.Code, resp.Message)
 	}
 
+	parameters = map[string]interface{}{
+		"symbol":     symbol.GetSymbol(),
+		"orderId":    resp.OrderID,
+		"isIsolated": "FALSE",
+		"timestamp":  c.Clock.Now(),
+	}
+
+	if err := c.PerformSign(parameters, "/sapi/v1/margin/myTrades", "GET", &resp.Fills); err != nil {
+		return nil, err
+	}
+
+	return resp.result(), nil
+}
+
+type binanceOrderFill struct {
+	Price           string `json:"price"`
+	Quantity        string `json:"qty"`
+	Commission      string `json:"commission"`
+	CommissionAsset string `json:"commissionAsset"`
+}
+
+type binanceOrderResponse struct {
+	Code          int                `json:"code"`
+	Message       string             `json:"msg"`
+	Symbol        string             `json:"symbol"`
+	OrderID       int64              `json:"orderId"`
+	ClientOrderID string             `json:"clientOrderId"`
+	TransactTime  int64              `json:"transactTime"`
+	Time          int64              `json:"time"`
+	UpdateTime    int64              `json:"updateTime"`
+	Status        string             `json:"status"`
+	Quantity      string             `json:"executedQty"`
+	Side          string             `json:"side"`
+	QuoteQuantity string             `json:"cummulativeQuoteQty"`
+	Fills         []binanceOrderFill `json:"fills"`
+}
+
+func (resp *binanceOrderResponse) result() *OrderResult {
 	qty, _ := strconv.ParseFloat(resp.Quantity, 64)
+	quote, _ := strconv.ParseFloat(resp.QuoteQuantity, 64)
 
-	return qty, nil
+	fees := make(map[string]float64)
+	for _, fill := range resp.Fills {
+		commission, _ := strconv.ParseFloat(fill.Commission, 64)
+		fees[fill.CommissionAsset] += commission
+	}
+
+	avg := 0.0
+	if qty > 0 {
+		avg = quote / qty
+	}
+
+	created := resp.TransactTime
+	if created == 0 {
+		created = resp.Time
+	}
+	updated := resp.UpdateTime
+	if updated == 0 {
+		updated = created
+	}
+
+	return &OrderResult{
+		OrderID:       strconv.FormatInt(resp.OrderID, 10),
+		ClientOrderID: resp.ClientOrderID,
+		Symbol:        resp.Symbol,
+		Side:          resp.Side,
+		Status:        resp.Status,
+		ExecutedQty:   qty,
+		QuoteQty:      quote,
+		AvgPrice:      avg,
+		Fees:          fees,
+		CreatedAt:     time.UnixMilli(created),
+		UpdatedAt:     time.UnixMilli(updated),
+	}
 }
@@ -0,0 +1,49 @@
+package market
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestBinanceDiffBookResyncBackoff(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, `{"code":-1003,"msg":"Too many requests."}`)
+	}))
+	defer srv.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := &BinancePublicClient{name: "BINANCE", Endpoints: Endpoints{Rest: srv.URL}, Logger: logger}
+
+	failed := make(chan error, 10)
+	book := newBinanceDiffBook(client, client.CreateSymbol("ETH+BTC"), "100",
+		func(event *OrderBookEvent) {}, func(err error) { failed <- err })
+
+	diff := func(id int) []byte {
+		return []byte(fmt.Sprintf(`{"e":"depthUpdate","E":%d,"U":%d,"u":%d,"b":[["0.05","1"]],"a":[]}`, id, id, id))
+	}
+
+	book.process(diff(1))
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the snapshot is not requested")
+	}
+
+	for id := 2; id < 10; id++ {
+		book.process(diff(id))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d snapshot requests right after a failure, want 1", n)
+	}
+}
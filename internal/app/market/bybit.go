@@ -13,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"tarbitrage/pkg/decimal"
 	"tarbitrage/pkg/websocket"
 	"time"
 
@@ -20,23 +21,24 @@ import (
 )
 
 type BybitPublicClient struct {
-	name   string
-	Logger *logrus.Logger
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
 }
 
 type BybitPrivateClient struct {
-	name   string
-	Key    string
-	Secret string
-	Logger *logrus.Logger
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Logger     *logrus.Logger
+	Clock      Clock
+	RecvWindow time.Duration
 }
 
-var BybitHost = "https://api.bybit.com"
-var BybitPublicWsUrl = "wss://stream.bybit.com/v5/public/spot"
-
 var BybitHeaders = map[string]string{
-	"Content-Type":       "application/json",
-	"X-BAPI-RECV-WINDOW": "5000",
+	"Content-Type": "application/json",
 }
 
 var BybitSides = map[string]string{
@@ -51,6 +53,7 @@ type BybitSymbol struct {
 	BaseSymbol     string
 	BasePrecision  int
 	PricePrecision int
+	Filters        SymbolFilters
 }
 
 func (s *BybitSymbol) GetBaseAsset() string {
@@ -85,10 +88,23 @@ func (s *BybitSymbol) SetPricePrecision(prec int) {
 	s.PricePrecision = prec
 }
 
+func (s *BybitSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *BybitSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
 func (c *BybitPublicClient) Name() string {
 	return c.name
 }
 
+// SetHeartbeat sets the interval of application-level pings, zero disables them.
+func (c *BybitPublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
 func (c *BybitPrivateClient) Name() string {
 	return c.name
 }
@@ -101,6 +117,11 @@ func (c *BybitPrivateClient) GetSecret() string {
 	return c.Secret
 }
 
+// SupportsShort is true, orders borrow on the cross margin account.
+func (c *BybitPrivateClient) SupportsShort() bool {
+	return true
+}
+
 func (c *BybitPublicClient) CreateSymbol(base_symbol string) MarketSymbol {
 	assets := strings.Split(base_symbol, "+")
 	return &BybitSymbol{
@@ -111,38 +132,100 @@ func (c *BybitPublicClient) CreateSymbol(base_symbol string) MarketSymbol {
 	}
 }
 
-func (c *BybitPublicClient) RunOrderBookStream(symbol MarketSymbol, levels string, handler OrderBookHandler,
-	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+// BybitMaxTopics is the number of topics subscribed over a single connection
+// and BybitMaxArgs the number of topics a single subscribe request may carry.
+var BybitMaxTopics = 200
+var BybitMaxArgs = 10
 
-	endpoint := BybitPublicWsUrl
-	wsApp := new(websocket.WebSocketApp)
-	var snapshotA, snapshotB map[string]string
+// RunOrderBookStreams subscribes the symbols over the given number of
+// connections; levels must be 1, 50 or 200.
+func (c *BybitPublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
 
-	type eventData struct {
-		Symbol string     `json:"s"`
-		Asks   [][]string `json:"a"`
-		Bids   [][]string `json:"b"`
+	if levels != "1" && levels != "50" && levels != "200" {
+		levels = "1"
 	}
-	type event struct {
-		Type string    `json:"type"`
-		Data eventData `json:"data"`
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, BybitMaxTopics) {
+		books := make([]*bybitBook, len(group))
+		for i, symbol := range group {
+			books[i] = &bybitBook{
+				client:  c,
+				symbol:  symbol,
+				topic:   fmt.Sprintf("orderbook.%s.%s", levels, symbol.GetSymbol()),
+				local:   NewLocalOrderBook(),
+				handler: handler,
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
 	}
-	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
-		if levels != "1" && levels != "50" && levels != "200" {
-			levels = "1"
+
+	return streams, nil
+}
+
+type bybitEventData struct {
+	Symbol   string     `json:"s"`
+	Asks     [][]string `json:"a"`
+	Bids     [][]string `json:"b"`
+	UpdateID int64      `json:"u"`
+	Sequence int64      `json:"seq"`
+}
+
+type bybitEvent struct {
+	Topic string         `json:"topic"`
+	Time  int64          `json:"ts"`
+	Type  string         `json:"type"`
+	Data  bybitEventData `json:"data"`
+}
+
+func bybitSubscribe(ws *websocket.WebSocketApp, op string, topics []string) {
+	for i := 0; i < len(topics); i += BybitMaxArgs {
+		j := i + BybitMaxArgs
+		if j > len(topics) {
+			j = len(topics)
 		}
 		subscription := map[string]interface{}{
 			"req_id": strconv.FormatInt(time.Now().UnixMilli(), 10),
-			"op":     "subscribe",
-			"args": []string{
-				fmt.Sprintf("orderbook.%s.%s", levels, symbol.GetSymbol()),
-			},
+			"op":     op,
+			"args":   topics[i:j],
 		}
 		ws.Send(subscription)
-		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s has been started.\n", c.Name(), symbol.GetBaseSymbol()))
+	}
+}
+
+func (c *BybitPublicClient) runDepthConnection(id int, books []*bybitBook,
+	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+
+	endpoint := c.Endpoints.Ws
+	wsApp := new(websocket.WebSocketApp)
+
+	byTopic := make(map[string]*bybitBook, len(books))
+	topics := make([]string, len(books))
+	for idx, book := range books {
+		byTopic[book.topic] = book
+		topics[idx] = book.topic
+	}
+
+	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.local.Reset()
+			book.handler(StaleEvent(book.symbol.GetBaseSymbol()))
+		}
+		bybitSubscribe(ws, "subscribe", topics)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
 	}
 	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
-		e := new(event)
+		e := new(bybitEvent)
 		err := json.Unmarshal(message, e)
 
 		if err != nil {
@@ -150,66 +233,32 @@ func (c *BybitPublicClient) RunOrderBookStream(symbol MarketSymbol, levels strin
 			return
 		}
 
-		switch e.Type {
-		case "snapshot":
-
-			snapshotA = make(map[string]string)
-			snapshotB = make(map[string]string)
-			bids := e.Data.Bids
-			asks := e.Data.Asks
-
-			for _, price_level := range bids {
-				snapshotB[price_level[0]] = price_level[1]
-			}
-
-			for _, price_level := range asks {
-				snapshotA[price_level[0]] = price_level[1]
-			}
-		case "delta":
-			bids := e.Data.Bids
-			asks := e.Data.Asks
-
-			for _, delta := range bids {
-				if delta[1] == "0" {
-					delete(snapshotB, delta[0])
-				} else {
-					snapshotB[delta[0]] = delta[1]
-				}
-			}
-			for _, delta := range asks {
-				if delta[1] == "0" {
-					delete(snapshotA, delta[0])
-				} else {
-					snapshotA[delta[0]] = delta[1]
-				}
-			}
-		default:
+		book, ok := byTopic[e.Topic]
+		if !ok {
 			return
 		}
-		book := new(OrderBookEvent)
-		book.Symbol = symbol.GetBaseSymbol()
-		book.Asks = make([]PriceLevel, 0)
-		book.Bids = make([]PriceLevel, 0)
-		for p, q := range snapshotA {
-			price, _ := strconv.ParseFloat(p, 64)
-			quantity, _ := strconv.ParseFloat(q, 64)
-			book.Asks = append(book.Asks, PriceLevel{Price: price, Quantity: quantity})
-		}
-		for p, q := range snapshotB {
-			price, _ := strconv.ParseFloat(p, 64)
-			quantity, _ := strconv.ParseFloat(q, 64)
-			book.Bids = append(book.Bids, PriceLevel{Price: price, Quantity: quantity})
-		}
 
-		handler(book)
+		book.process(ws, e)
 	}
 	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
 		c.Logger.Log(logrus.InfoLevel, "STREAM ERROR", err)
 	}
 	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
-		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s is stopped.\n", c.Name(), symbol.GetBaseSymbol()))
-		if ws.IsRunning {
-			ws.Run(ws.Config.Endpoint, ws.Config.WebsocketKeepalive, ws.Config.Timeout)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
+		}
+	}
+	wsApp.Heartbeat = c.Heartbeat
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		ping := map[string]interface{}{
+			"req_id": strconv.FormatInt(time.Now().UnixMilli(), 10),
+			"op":     "ping",
+		}
+		if err := ws.Send(ping); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
 		}
 	}
 
@@ -220,6 +269,43 @@ func (c *BybitPublicClient) RunOrderBookStream(symbol MarketSymbol, levels strin
 	return wsApp, nil
 }
 
+type bybitBook struct {
+	client  *BybitPublicClient
+	symbol  MarketSymbol
+	topic   string
+	local   *LocalOrderBook
+	handler OrderBookHandler
+}
+
+func (b *bybitBook) process(ws *websocket.WebSocketApp, e *bybitEvent) {
+	switch e.Type {
+	case "snapshot":
+		b.local.ApplySnapshot(e.Data.Asks, e.Data.Bids)
+	case "delta":
+		if b.local.IsEmpty() {
+			// waiting for a snapshot after a gap
+			return
+		}
+		if e.Data.UpdateID != b.local.UpdateID+1 || e.Data.Sequence <= b.local.Sequence {
+			b.client.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s: gap in updates (u %d -> %d), resubscribing.\n",
+				b.client.Name(), b.symbol.GetBaseSymbol(), b.local.UpdateID, e.Data.UpdateID))
+			b.local.Reset()
+			b.handler(StaleEvent(b.symbol.GetBaseSymbol()))
+			bybitSubscribe(ws, "unsubscribe", []string{b.topic})
+			bybitSubscribe(ws, "subscribe", []string{b.topic})
+			return
+		}
+		b.local.ApplyDelta(e.Data.Asks, e.Data.Bids)
+	default:
+		return
+	}
+	b.local.UpdateID = e.Data.UpdateID
+	b.local.Sequence = e.Data.Sequence
+	b.local.EventTime = time.UnixMilli(e.Time)
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
 func (c *BybitPublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
 	keys := make([]string, 0, len(query))
 	for k := range query {
@@ -248,7 +334,7 @@ func (c *BybitPublicClient) Perform(query map[string]interface{}, method string,
 	}
 	queryString := strings.Join(queryStrings, "&")
 
-	url := fmt.Sprintf("%s/%s?%s", BybitHost, method, queryString)
+	url := fmt.Sprintf("%s/%s?%s", c.Endpoints.Rest, method, queryString)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	req, err := http.NewRequest(session_method, url, nil)
@@ -289,6 +375,10 @@ func (c *BybitPublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
 	type filter struct {
 		BasePrecision string `json:"basePrecision"`
 		TickSize      string `json:"tickSize"`
+		MinOrderQty   string `json:"minOrderQty"`
+		MaxOrderQty   string `json:"maxOrderQty"`
+		MinOrderAmt   string `json:"minOrderAmt"`
+		MaxOrderAmt   string `json:"maxOrderAmt"`
 	}
 
 	type SymbolData struct {
@@ -336,11 +426,104 @@ func (c *BybitPublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
 		}
 		s.SetBasePrecision(GetPrecision(data.LotSizeFilter.BasePrecision))
 		s.SetPricePrecision(GetPrecision(data.PriceFilter.TickSize))
+
+		filters := SymbolFilters{}
+		filters.StepSize, _ = decimal.Parse(data.LotSizeFilter.BasePrecision)
+		filters.MinQty, _ = decimal.Parse(data.LotSizeFilter.MinOrderQty)
+		filters.MaxQty, _ = decimal.Parse(data.LotSizeFilter.MaxOrderQty)
+		filters.MinNotional, _ = decimal.Parse(data.LotSizeFilter.MinOrderAmt)
+		filters.MaxNotional, _ = decimal.Parse(data.LotSizeFilter.MaxOrderAmt)
+		filters.TickSize, _ = decimal.Parse(data.PriceFilter.TickSize)
+		s.SetFilters(filters)
 	}
 
 	return nil
 }
 
+func (c *BybitPublicClient) GetSpotInstruments() ([]Instrument, error) {
+	parameters := map[string]interface{}{
+		"category": "spot",
+		"limit":    1000,
+	}
+
+	type SymbolData struct {
+		Symbol     string `json:"symbol"`
+		BaseAsset  string `json:"baseCoin"`
+		QuoteAsset string `json:"quoteCoin"`
+		Status     string `json:"status"`
+		Margin     string `json:"marginTrading"`
+	}
+
+	type result struct {
+		List []SymbolData `json:"list"`
+	}
+
+	type response struct {
+		Message string `json:"retMsg"`
+		Code    int    `json:"retCode"`
+		Result  result `json:"result"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(parameters, "/v5/market/instruments-info", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("bybit error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	type ticker struct {
+		Symbol    string `json:"symbol"`
+		LastPrice string `json:"lastPrice"`
+		Turnover  string `json:"turnover24h"`
+	}
+
+	type tickersResult struct {
+		List []ticker `json:"list"`
+	}
+
+	type tickersResponse struct {
+		Message string        `json:"retMsg"`
+		Code    int           `json:"retCode"`
+		Result  tickersResult `json:"result"`
+	}
+
+	tickers := new(tickersResponse)
+
+	if err := c.Perform(map[string]interface{}{"category": "spot"}, "/v5/market/tickers", "GET", tickers); err != nil {
+		return nil, err
+	}
+
+	if tickers.Code != 0 {
+		return nil, fmt.Errorf("bybit error: code: %d, message: %s", tickers.Code, tickers.Message)
+	}
+
+	stats := make(map[string]ticker, len(tickers.Result.List))
+	for _, t := range tickers.Result.List {
+		stats[t.Symbol] = t
+	}
+
+	instruments := make([]Instrument, 0, len(resp.Result.List))
+	for _, data := range resp.Result.List {
+		if data.Status != "Trading" {
+			continue
+		}
+		price, _ := strconv.ParseFloat(stats[data.Symbol].LastPrice, 64)
+		volume, _ := strconv.ParseFloat(stats[data.Symbol].Turnover, 64)
+		instruments = append(instruments, Instrument{
+			BaseAsset:   data.BaseAsset,
+			QuoteAsset:  data.QuoteAsset,
+			Margin:      data.Margin != "none" && data.Margin != "",
+			LastPrice:   price,
+			QuoteVolume: volume,
+		})
+	}
+
+	return instruments, nil
+}
+
 func PreparePayload(method string, parameters map[string]interface{}) (string, error) {
 	// Function to cast values to specific types
 	castValues := func() error {
@@ -394,8 +577,7 @@ func PreparePayload(method string, parameters map[string]interface{}) (string, e
 
 func (c *BybitPrivateClient) generateSignature(queryString string, timestamp int64) (string, error) {
 	// Combine data for signing
-	recvWindow, _ := strconv.Atoi(BybitHeaders["X-BAPI-RECV-WINDOW"])
-	data := fmt.Sprintf("%d%s%d%s", timestamp, c.Key, recvWindow, queryString)
+	data := fmt.Sprintf("%d%s%d%s", timestamp, c.Key, c.recvWindow(), queryString)
 
 	// Create HMAC with SHA256
 	h := hmac.New(sha256.New, []byte(c.Secret))
@@ -434,24 +616,19 @@ func (c *BybitPrivateClient) PerformSign(query map[string]interface{}, method st
 		return err
 	}
 
-	timestamp := time.Now().UnixMilli()
+	timestamp := c.Clock.Now()
 	signature, err := c.generateSignature(query_string, timestamp)
 	if err != nil {
 		return err
 	}
 
-	BybitHeaders["X-BAPI-API-KEY"] = c.Key
-	BybitHeaders["X-BAPI-SIGN"] = signature
-	BybitHeaders["X-BAPI-SIGN-TYPE"] = "2"
-	BybitHeaders["X-BAPI-TIMESTAMP"] = strconv.FormatInt(timestamp, 10)
-
 	var url string
 	var reqBody []byte
 
 	if session_method == "GET" {
-		url = fmt.Sprintf("%s/%s?%s", BybitHost, method, query_string)
+		url = fmt.Sprintf("%s/%s?%s", c.Endpoints.Rest, method, query_string)
 	} else {
-		url = fmt.Sprintf("%s/%s", BybitHost, method)
+		url = fmt.Sprintf("%s/%s", c.Endpoints.Rest, method)
 		reqBody = []byte(query_string)
 	}
 
@@ -465,6 +642,11 @@ func (c *BybitPrivateClient) PerformSign(query map[string]interface{}, method st
 	for key, value := range BybitHeaders {
 		req.Header.Set(key, value)
 	}
+	req.Header.Set("X-BAPI-API-KEY", c.Key)
+	req.Header.Set("X-BAPI-SIGN", signature)
+	req.Header.Set("X-BAPI-SIGN-TYPE", "2")
+	req.Header.Set("X-BAPI-TIMESTAMP", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-BAPI-RECV-WINDOW", strconv.FormatInt(c.recvWindow(), 10))
 
 	if reqBody != nil {
 		req.Body = io.NopCloser(bytes.NewReader(reqBody))
@@ -489,6 +671,45 @@ func (c *BybitPrivateClient) PerformSign(query map[string]interface{}, method st
 	return nil
 }
 
+func (c *BybitPrivateClient) recvWindow() int64 {
+	if c.RecvWindow <= 0 {
+		return DefaultRecvWindow.Milliseconds()
+	}
+	return c.RecvWindow.Milliseconds()
+}
+
+// SyncTime measures the offset of the local clock from /v5/market/time.
+func (c *BybitPrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type server struct {
+			TimeNano string `json:"timeNano"`
+		}
+
+		type result struct {
+			Result  server `json:"result"`
+			Code    int    `json:"retCode"`
+			Message string `json:"retMsg"`
+		}
+
+		resp := new(result)
+		if err := (&BybitPublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "/v5/market/time", "GET", resp); err != nil {
+			return 0, err
+		}
+		if resp.Code != 0 {
+			return 0, fmt.Errorf("bybit error: code: %d, message: %s", resp.Code, resp.Message)
+		}
+		nano, err := strconv.ParseInt(resp.Result.TimeNano, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return nano / int64(time.Millisecond), nil
+	})
+}
+
+func (c *BybitPrivateClient) SetRecvWindow(window time.Duration) {
+	c.RecvWindow = window
+}
+
 func (c *BybitPrivateClient) ApplyInitial(lot float64) error {
 
 	balance, err := c.GetMarginBalance()
@@ -586,16 +807,142 @@ func (c *BybitPrivateClient) GetMarginBalance() (float64, error) {
 	return available, nil
 }
 
-func (c *BybitPrivateClient) PlaceOrder(symbol, side, t, quantity string) (float64, error) {
+// GetBalances returns the unified account position of every coin; the wallet
+// balance includes the locked amount.
+func (c *BybitPrivateClient) GetBalances() (map[string]Balance, error) {
+	parameters := map[string]interface{}{
+		"accountType": "UNIFIED",
+	}
+
+	type coin struct {
+		Coin     string `json:"coin"`
+		Wallet   string `json:"walletBalance"`
+		Locked   string `json:"locked"`
+		Borrowed string `json:"borrowAmount"`
+		Interest string `json:"accruedInterest"`
+	}
+
+	type info struct {
+		Coins []coin `json:"coin"`
+	}
+
+	type list struct {
+		List []info `json:"list"`
+	}
+
+	type result struct {
+		Result  list   `json:"result"`
+		Code    int    `json:"retCode"`
+		Message string `json:"retMsg"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/v5/account/wallet-balance", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("bybit error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	balances := make(map[string]Balance)
+	for _, account := range resp.Result.List {
+		for _, c := range account.Coins {
+			balance := Balance{Asset: c.Coin}
+			wallet, _ := strconv.ParseFloat(c.Wallet, 64)
+			balance.Locked, _ = strconv.ParseFloat(c.Locked, 64)
+			balance.Borrowed, _ = strconv.ParseFloat(c.Borrowed, 64)
+			balance.Interest, _ = strconv.ParseFloat(c.Interest, 64)
+			balance.Free = wallet - balance.Locked
+			balances[c.Coin] = balance
+		}
+	}
+
+	return balances, nil
+}
+
+// Repay repays the liability of the coin from its available balance. The
+// unified account always repays as much as is available, so the amount only
+// tells whether there is anything to repay.
+func (c *BybitPrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	if amount.Sign() <= 0 {
+		return nil
+	}
+
+	parameters := map[string]interface{}{
+		"coin": asset,
+	}
+
+	type result struct {
+		Code    int    `json:"retCode"`
+		Message string `json:"retMsg"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/v5/account/quick-repayment", "POST", resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("bybit error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	return nil
+}
+
+// GetFees returns the taker fee in percent per base symbol.
+func (c *BybitPrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	parameters := map[string]interface{}{
+		"category": "spot",
+	}
+
+	type fee struct {
+		Symbol string `json:"symbol"`
+		Taker  string `json:"takerFeeRate"`
+	}
+
+	type list struct {
+		List []fee `json:"list"`
+	}
+
+	type result struct {
+		Result  list   `json:"result"`
+		Code    int    `json:"retCode"`
+		Message string `json:"retMsg"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/v5/account/fee-rate", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("bybit error: code: %d, message: %s", resp.Code, resp.Message)
+	}
+
+	rates := make(map[string]float64, len(resp.Result.List))
+	for _, f := range resp.Result.List {
+		rate, _ := strconv.ParseFloat(f.Taker, 64)
+		rates[f.Symbol] = rate * 100
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		if rate, ok := rates[s.GetSymbol()]; ok {
+			fees[s.GetBaseSymbol()] = rate
+		}
+	}
+
+	return fees, nil
+}
+
+func (c *BybitPrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
 
 	parameters := map[string]interface{}{
 		"category":    "spot",
-		"symbol":      symbol,
+		"symbol":      symbol.GetSymbol(),
 		"side":        BybitSides[side],
 		"orderType":   "Market",
 		"isLeverage":  1,
-		"qty":         quantity,
-		"orderLinkId": strconv.FormatInt(time.Now().UnixMilli(), 10),
+		"qty":         quantity.String(),
+		"orderLinkId": clientID,
 	}
 
 	switch t {
@@ -619,30 +966,44 @@ func (c *BybitPrivateClient) PlaceOrder(symbol, side, t, quantity string) (float
 	resp := new(response)
 
 	if err := c.PerformSign(parameters, "/v5/order/create", "POST", resp); err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if resp.Code != 0 {
-		return 0, fmt.Errorf("bybit error while creating order: code: %d, message: %s", resp.Code, resp.Message)
+		return nil, fmt.Errorf("bybit error while creating order: code: %d, message: %s", resp.Code, resp.Message)
 	}
 
-	orderData, err := c.GetOrderInfo(symbol, resp.Result.OrderID)
+	orderData, err := c.GetOrderInfo(symbol.GetSymbol(), resp.Result.OrderID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	qty, _ := strconv.ParseFloat(orderData.Quantity, 64)
-
-	return qty, nil
+	return orderData.result(symbol), nil
 }
 
 func (c *BybitPrivateClient) GetOrderInfo(symbol string, orderID string) (*BybitOrderData, error) {
-	parameters := map[string]interface{}{
+	return c.queryOrder(map[string]interface{}{
 		"category": "spot",
 		"symbol":   symbol,
 		"orderId":  orderID,
+	})
+}
+
+// GetOrder looks the order up by client id among the recent orders and then
+// in the order history.
+func (c *BybitPrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	orderData, err := c.queryOrder(map[string]interface{}{
+		"category":    "spot",
+		"symbol":      symbol.GetSymbol(),
+		"orderLinkId": clientID,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return orderData.result(symbol), nil
+}
 
+func (c *BybitPrivateClient) queryOrder(parameters map[string]interface{}) (*BybitOrderData, error) {
 	type result struct {
 		List []BybitOrderData `json:"list"`
 	}
@@ -653,25 +1014,67 @@ func (c *BybitPrivateClient) GetOrderInfo(symbol string, orderID string) (*Bybit
 		Result  result `json:"result"`
 	}
 
-	resp := new(response)
+	for _, method := range []string{"/v5/order/realtime", "/v5/order/history"} {
+		resp := new(response)
 
-	if err := c.PerformSign(parameters, "/v5/order/realtime", "GET", resp); err != nil {
-		return nil, err
-	}
+		if err := c.PerformSign(parameters, method, "GET", resp); err != nil {
+			return nil, err
+		}
 
-	if resp.Code != 0 {
-		return nil, fmt.Errorf("bybit error while fetching order data: code: %d, message: %s", resp.Code, resp.Message)
-	}
+		if resp.Code != 0 {
+			return nil, fmt.Errorf("bybit error while fetching order data: code: %d, message: %s", resp.Code, resp.Message)
+		}
 
-	data := resp.Result.List[0]
+		if len(resp.Result.List) > 0 {
+			data := resp.Result.List[0]
+			return &data, nil
+		}
+	}
 
-	return &data, nil
+	return nil, ErrOrderNotFound
 }
 
 type BybitOrderData struct {
-	Price         string `json:"price"`
-	Quantity      string `json:"qty"`
+	OrderID       string `json:"orderId"`
+	ClientOrderID string `json:"orderLinkId"`
+	Symbol        string `json:"symbol"`
+	Status        string `json:"orderStatus"`
+	Price         string `json:"avgPrice"`
+	Quantity      string `json:"cumExecQty"`
 	Side          string `json:"side"`
 	QuoteQuantity string `json:"cumExecValue"`
 	Commission    string `json:"cumExecFee"`
+	CreatedTime   string `json:"createdTime"`
+	UpdatedTime   string `json:"updatedTime"`
+}
+
+// result converts the order data; spot fees are charged in the received
+// asset, i.e. the base asset for Buy and the quote asset for Sell.
+func (d *BybitOrderData) result(symbol MarketSymbol) *OrderResult {
+	qty, _ := strconv.ParseFloat(d.Quantity, 64)
+	quote, _ := strconv.ParseFloat(d.QuoteQuantity, 64)
+	price, _ := strconv.ParseFloat(d.Price, 64)
+	commission, _ := strconv.ParseFloat(d.Commission, 64)
+	created, _ := strconv.ParseInt(d.CreatedTime, 10, 64)
+	updated, _ := strconv.ParseInt(d.UpdatedTime, 10, 64)
+
+	side := strings.ToUpper(d.Side)
+	feeAsset := symbol.GetQuoteAsset()
+	if side == "BUY" {
+		feeAsset = symbol.GetBaseAsset()
+	}
+
+	return &OrderResult{
+		OrderID:       d.OrderID,
+		ClientOrderID: d.ClientOrderID,
+		Symbol:        d.Symbol,
+		Side:          side,
+		Status:        d.Status,
+		ExecutedQty:   qty,
+		QuoteQty:      quote,
+		AvgPrice:      price,
+		Fees:          map[string]float64{feeAsset: commission},
+		CreatedAt:     time.UnixMilli(created),
+		UpdatedAt:     time.UnixMilli(updated),
+	}
 }
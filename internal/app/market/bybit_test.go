@@ -0,0 +1,46 @@
+package market
+
+import (
+	"io"
+	"tarbitrage/pkg/websocket"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestBybitBookGap(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := &BybitPublicClient{name: "BYBIT", Logger: logger}
+
+	var got *OrderBookEvent
+	book := &bybitBook{
+		client:  client,
+		symbol:  client.CreateSymbol("ETH+BTC"),
+		topic:   "orderbook.50.ETHBTC",
+		local:   NewLocalOrderBook(),
+		handler: func(event *OrderBookEvent) { got = event },
+	}
+	// not connected, the resubscription is dropped
+	ws := new(websocket.WebSocketApp)
+
+	book.process(ws, &bybitEvent{Type: "snapshot", Time: 1, Data: bybitEventData{
+		Asks: [][]string{{"0.0501", "1"}}, Bids: [][]string{{"0.05", "2"}}, UpdateID: 1, Sequence: 1}})
+	if got == nil || got.Stale || len(got.Asks) != 1 {
+		t.Fatalf("snapshot event = %+v", got)
+	}
+
+	book.process(ws, &bybitEvent{Type: "delta", Time: 2, Data: bybitEventData{
+		Asks: [][]string{{"0.0502", "1"}}, UpdateID: 3, Sequence: 3}})
+	if !got.Stale || len(got.Asks) != 0 || len(got.Bids) != 0 {
+		t.Errorf("the book is not stored stale after a gap: %+v", got)
+	}
+
+	// deltas are ignored until the next snapshot
+	got = nil
+	book.process(ws, &bybitEvent{Type: "delta", Time: 3, Data: bybitEventData{
+		Asks: [][]string{{"0.0503", "1"}}, UpdateID: 4, Sequence: 4}})
+	if got != nil {
+		t.Errorf("event before the snapshot: %+v", got)
+	}
+}
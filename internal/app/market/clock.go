@@ -0,0 +1,39 @@
+package market
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRecvWindow is how long after its timestamp a signed request is
+// accepted by the exchange.
+const DefaultRecvWindow = 5 * time.Second
+
+// Clock keeps the offset of the exchange clock from the local one, so that
+// signed requests carry the server time even when the local clock drifts.
+type Clock struct {
+	offset int64
+}
+
+// Now is the estimated server time in milliseconds.
+func (c *Clock) Now() int64 {
+	return time.Now().UnixMilli() + atomic.LoadInt64(&c.offset)
+}
+
+func (c *Clock) Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.offset)) * time.Millisecond
+}
+
+// Sync measures the offset against the server time in milliseconds, taken
+// as of the middle of the request round trip.
+func (c *Clock) Sync(server func() (int64, error)) (time.Duration, error) {
+	sent := time.Now().UnixMilli()
+	now, err := server()
+	if err != nil {
+		return c.Offset(), err
+	}
+	received := time.Now().UnixMilli()
+
+	atomic.StoreInt64(&c.offset, now-(sent+received)/2)
+	return c.Offset(), nil
+}
@@ -0,0 +1,77 @@
+package market
+
+import "fmt"
+
+// Endpoints are the REST host and the public WebSocket url a client talks to.
+// PublicOnly endpoints serve market data but not the margin trading API.
+type Endpoints struct {
+	Rest       string
+	Ws         string
+	PublicOnly bool
+}
+
+// Networks are the endpoint presets of every market. KuCoin gets its
+// WebSocket url from the bullet request, so it only needs the REST host. The
+// Binance Spot Testnet has no /sapi endpoints, so no margin account, and can
+// only feed the paper client.
+var Networks = map[string]map[string]Endpoints{
+	"BINANCE": {
+		"mainnet": {Rest: "https://api.binance.com", Ws: "wss://stream.binance.com:9443/stream"},
+		"testnet": {Rest: "https://testnet.binance.vision", Ws: "wss://stream.testnet.binance.vision/stream", PublicOnly: true},
+	},
+	"BYBIT": {
+		"mainnet": {Rest: "https://api.bybit.com", Ws: "wss://stream.bybit.com/v5/public/spot"},
+		"testnet": {Rest: "https://api-testnet.bybit.com", Ws: "wss://stream-testnet.bybit.com/v5/public/spot"},
+	},
+	"OKX": {
+		"mainnet": {Rest: "https://www.okx.com", Ws: "wss://ws.okx.com:8443/ws/v5/public"},
+	},
+	"KRAKEN": {
+		"mainnet": {Rest: "https://api.kraken.com", Ws: "wss://ws.kraken.com/v2"},
+	},
+	"KUCOIN": {
+		"mainnet": {Rest: "https://api.kucoin.com"},
+	},
+	"GATE": {
+		"mainnet": {Rest: "https://api.gateio.ws", Ws: "wss://api.gateio.ws/ws/v4/"},
+	},
+}
+
+// GetEndpoints returns the preset of the network ("mainnet" when empty) with
+// rest and ws overriding it when they are set. The "custom" network has no
+// preset and takes both from the arguments, e.g. to run against a local mock
+// server.
+func GetEndpoints(market, network, rest, ws string) (Endpoints, error) {
+	presets, ok := Networks[market]
+	if !ok {
+		return Endpoints{}, fmt.Errorf("unsupported market: %s", market)
+	}
+
+	if network == "" {
+		network = "mainnet"
+	}
+
+	endpoints := Endpoints{}
+	if network != "custom" {
+		endpoints, ok = presets[network]
+		if !ok {
+			return Endpoints{}, fmt.Errorf("unsupported network %s for market %s", network, market)
+		}
+	}
+
+	if rest != "" {
+		endpoints.Rest = rest
+	}
+	if ws != "" {
+		endpoints.Ws = ws
+	}
+
+	if endpoints.Rest == "" {
+		return Endpoints{}, fmt.Errorf("rest url is required for the %s network", network)
+	}
+	if endpoints.Ws == "" && market != "KUCOIN" {
+		return Endpoints{}, fmt.Errorf("websocket url is required for the %s network", network)
+	}
+
+	return endpoints, nil
+}
@@ -0,0 +1,824 @@
+package market
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"tarbitrage/pkg/decimal"
+	"tarbitrage/pkg/websocket"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type GatePublicClient struct {
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
+}
+
+type GatePrivateClient struct {
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Logger     *logrus.Logger
+	Clock      Clock
+	RecvWindow time.Duration
+}
+
+var GateHeaders = map[string]string{
+	"Accept":       "application/json",
+	"Content-Type": "application/json",
+}
+
+var GateSides = map[string]string{
+	"BUY":  "buy",
+	"SELL": "sell",
+}
+
+type GateSymbol struct {
+	BaseAsset      string
+	QuoteAsset     string
+	Symbol         string
+	BaseSymbol     string
+	BasePrecision  int
+	PricePrecision int
+	Filters        SymbolFilters
+}
+
+func (s *GateSymbol) GetBaseAsset() string {
+	return s.BaseAsset
+}
+
+func (s *GateSymbol) GetQuoteAsset() string {
+	return s.QuoteAsset
+}
+
+func (s *GateSymbol) GetBaseSymbol() string {
+	return s.BaseSymbol
+}
+
+func (s *GateSymbol) GetSymbol() string {
+	return s.Symbol
+}
+
+func (s *GateSymbol) GetBasePrecision() int {
+	return s.BasePrecision
+}
+
+func (s *GateSymbol) GetPricePrecision() int {
+	return s.PricePrecision
+}
+
+func (s *GateSymbol) SetBasePrecision(prec int) {
+	s.BasePrecision = prec
+}
+
+func (s *GateSymbol) SetPricePrecision(prec int) {
+	s.PricePrecision = prec
+}
+
+func (s *GateSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *GateSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
+func (c *GatePublicClient) Name() string {
+	return c.name
+}
+
+// SetHeartbeat sets the interval of application-level pings, zero disables them.
+func (c *GatePublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
+func (c *GatePrivateClient) Name() string {
+	return c.name
+}
+
+func (c *GatePrivateClient) GetKey() string {
+	return c.Key
+}
+
+func (c *GatePrivateClient) GetSecret() string {
+	return c.Secret
+}
+
+// SupportsShort is true, orders borrow on the cross margin account.
+func (c *GatePrivateClient) SupportsShort() bool {
+	return true
+}
+
+// CreateSymbol maps "ETH+BTC" to the currency pair "ETH_BTC"; a currency pair
+// is accepted as well.
+func (c *GatePublicClient) CreateSymbol(base_symbol string) MarketSymbol {
+	assets := strings.Split(base_symbol, "+")
+	if len(assets) != 2 {
+		assets = strings.SplitN(base_symbol, "_", 2)
+	}
+	return &GateSymbol{
+		BaseAsset:  assets[0],
+		QuoteAsset: assets[1],
+		Symbol:     assets[0] + "_" + assets[1],
+		BaseSymbol: assets[0] + "+" + assets[1],
+	}
+}
+
+// GateMaxTopics is the number of pairs subscribed over a single connection.
+var GateMaxTopics = 200
+
+// RunOrderBookStreams subscribes the symbols to the spot.order_book channel;
+// levels must be 5, 10, 20, 50 or 100.
+func (c *GatePublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
+
+	switch levels {
+	case "5", "10", "20", "50", "100":
+	default:
+		levels = "5"
+	}
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, GateMaxTopics) {
+		books := make([]*gateBook, len(group))
+		for i, symbol := range group {
+			books[i] = &gateBook{
+				symbol:  symbol,
+				local:   NewLocalOrderBook(),
+				handler: handler,
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, levels, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
+	}
+
+	return streams, nil
+}
+
+type gateBookData struct {
+	Time   int64      `json:"t"`
+	Update int64      `json:"lastUpdateId"`
+	Symbol string     `json:"s"`
+	Asks   [][]string `json:"asks"`
+	Bids   [][]string `json:"bids"`
+}
+
+type gateError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type gateEvent struct {
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Error   *gateError      `json:"error"`
+	Result  json.RawMessage `json:"result"`
+}
+
+func (c *GatePublicClient) runDepthConnection(id int, books []*gateBook, levels string,
+	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+
+	endpoint := c.Endpoints.Ws
+	wsApp := new(websocket.WebSocketApp)
+
+	byPair := make(map[string]*gateBook, len(books))
+	for _, book := range books {
+		byPair[book.symbol.GetSymbol()] = book
+	}
+
+	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.local.Reset()
+			book.handler(StaleEvent(book.symbol.GetBaseSymbol()))
+			// the channel takes a single pair per subscription
+			subscription := map[string]interface{}{
+				"time":    time.Now().Unix(),
+				"channel": "spot.order_book",
+				"event":   "subscribe",
+				"payload": []string{book.symbol.GetSymbol(), levels, "100ms"},
+			}
+			ws.Send(subscription)
+		}
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
+	}
+	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
+		e := new(gateEvent)
+		err := json.Unmarshal(message, e)
+
+		if err != nil {
+			errHandler(err)
+			return
+		}
+
+		if e.Error != nil {
+			errHandler(fmt.Errorf("gate error: code: %d, message: %s", e.Error.Code, e.Error.Message))
+			return
+		}
+
+		if e.Channel != "spot.order_book" || e.Event != "update" {
+			return
+		}
+
+		data := new(gateBookData)
+		if err := json.Unmarshal(e.Result, data); err != nil {
+			errHandler(err)
+			return
+		}
+
+		book, ok := byPair[data.Symbol]
+		if !ok {
+			return
+		}
+
+		book.process(data)
+	}
+	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
+		c.Logger.Log(logrus.InfoLevel, err)
+	}
+	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
+		}
+	}
+	wsApp.Heartbeat = c.Heartbeat
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		ping := map[string]interface{}{
+			"time":    time.Now().Unix(),
+			"channel": "spot.ping",
+		}
+		if err := ws.Send(ping); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
+		}
+	}
+
+	if err := wsApp.Run(endpoint, false, 0); err != nil {
+		return nil, err
+	}
+
+	return wsApp, nil
+}
+
+type gateBook struct {
+	symbol  MarketSymbol
+	local   *LocalOrderBook
+	handler OrderBookHandler
+}
+
+// process replaces the book, every spot.order_book update is a snapshot of
+// the subscribed levels.
+func (b *gateBook) process(data *gateBookData) {
+	if len(data.Asks) == 0 {
+		return
+	}
+
+	b.local.ApplySnapshot(data.Asks, data.Bids)
+	b.local.UpdateID = data.Update
+	b.local.EventTime = time.UnixMilli(data.Time)
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
+type gatePairData struct {
+	ID              string `json:"id"`
+	Base            string `json:"base"`
+	Quote           string `json:"quote"`
+	MinBaseAmount   string `json:"min_base_amount"`
+	MaxBaseAmount   string `json:"max_base_amount"`
+	MinQuoteAmount  string `json:"min_quote_amount"`
+	MaxQuoteAmount  string `json:"max_quote_amount"`
+	AmountPrecision int    `json:"amount_precision"`
+	Precision       int    `json:"precision"`
+	Status          string `json:"trade_status"`
+}
+
+func (c *GatePublicClient) getCurrencyPairs() ([]gatePairData, error) {
+	pairs := make([]gatePairData, 0)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v4/spot/currency_pairs", "GET", &pairs); err != nil {
+		return nil, err
+	}
+
+	return pairs, nil
+}
+
+func (c *GatePublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
+	pairs, err := c.getCurrencyPairs()
+	if err != nil {
+		return err
+	}
+
+	byPair := make(map[string]gatePairData, len(pairs))
+	for _, data := range pairs {
+		byPair[data.ID] = data
+	}
+
+	for _, s := range symbols {
+		data, ok := byPair[s.GetSymbol()]
+		if !ok {
+			return fmt.Errorf("can't find precision information for symbol %s", s.GetBaseSymbol())
+		}
+		s.SetBasePrecision(data.AmountPrecision)
+		s.SetPricePrecision(data.Precision)
+
+		filters := SymbolFilters{}
+		filters.StepSize = decimal.New(1, int32(data.AmountPrecision))
+		filters.TickSize = decimal.New(1, int32(data.Precision))
+		filters.MinQty, _ = decimal.Parse(data.MinBaseAmount)
+		filters.MaxQty, _ = decimal.Parse(data.MaxBaseAmount)
+		filters.MinNotional, _ = decimal.Parse(data.MinQuoteAmount)
+		filters.MaxNotional, _ = decimal.Parse(data.MaxQuoteAmount)
+		s.SetFilters(filters)
+	}
+
+	return nil
+}
+
+// GetSpotInstruments lists the tradable pairs; a pair can be traded on cross
+// margin when both of its currencies are cross margin currencies.
+func (c *GatePublicClient) GetSpotInstruments() ([]Instrument, error) {
+	pairs, err := c.getCurrencyPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	type currency struct {
+		Name   string `json:"name"`
+		Status int    `json:"status"`
+	}
+
+	currencies := make([]currency, 0)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v4/margin/cross/currencies", "GET", &currencies); err != nil {
+		return nil, err
+	}
+
+	marginable := make(map[string]bool, len(currencies))
+	for _, cur := range currencies {
+		marginable[cur.Name] = cur.Status != 0
+	}
+
+	type ticker struct {
+		Pair      string `json:"currency_pair"`
+		LastPrice string `json:"last"`
+		Turnover  string `json:"quote_volume"`
+	}
+
+	tickers := make([]ticker, 0)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v4/spot/tickers", "GET", &tickers); err != nil {
+		return nil, err
+	}
+
+	stats := make(map[string]ticker, len(tickers))
+	for _, t := range tickers {
+		stats[t.Pair] = t
+	}
+
+	instruments := make([]Instrument, 0, len(pairs))
+	for _, data := range pairs {
+		if data.Status != "tradable" {
+			continue
+		}
+		price, _ := strconv.ParseFloat(stats[data.ID].LastPrice, 64)
+		volume, _ := strconv.ParseFloat(stats[data.ID].Turnover, 64)
+		instruments = append(instruments, Instrument{
+			BaseAsset:   data.Base,
+			QuoteAsset:  data.Quote,
+			Margin:      marginable[data.Base] && marginable[data.Quote],
+			LastPrice:   price,
+			QuoteVolume: volume,
+		})
+	}
+
+	return instruments, nil
+}
+
+// gateQuery joins the parameters sorted by key.
+func gateQuery(query map[string]interface{}) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var queryStrings []string
+	for _, k := range keys {
+		if v := query[k]; v != nil {
+			queryStrings = append(queryStrings, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	return strings.Join(queryStrings, "&")
+}
+
+// gateDecode reads the response; errors come as a label and a message with
+// a non-2xx status.
+func gateDecode(resp *http.Response, result interface{}) error {
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		type failure struct {
+			Label   string `json:"label"`
+			Message string `json:"message"`
+		}
+		f := new(failure)
+		if err := json.Unmarshal(res, f); err != nil || f.Label == "" {
+			return fmt.Errorf("gate error: status: %d, body: %s", resp.StatusCode, string(res))
+		}
+		if f.Label == "ORDER_NOT_FOUND" {
+			return ErrOrderNotFound
+		}
+		return fmt.Errorf("gate error: label: %s, message: %s", f.Label, f.Message)
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *GatePublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	url := c.Endpoints.Rest + method
+	if queryString := gateQuery(query); queryString != "" {
+		url += "?" + queryString
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range GateHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return gateDecode(resp, result)
+}
+
+// generateSignature signs method, path, query, SHA512 of the body and the
+// timestamp, separated by new lines, with HMAC-SHA512.
+func (c *GatePrivateClient) generateSignature(session_method, path, query, body, timestamp string) string {
+	hashed := sha512.Sum512([]byte(body))
+	data := strings.Join([]string{session_method, path, query, hex.EncodeToString(hashed[:]), timestamp}, "\n")
+
+	h := hmac.New(sha512.New, []byte(c.Secret))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// PerformSign sends the parameters in the query for GET and DELETE and as
+// json body otherwise.
+func (c *GatePrivateClient) PerformSign(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	queryString, body := "", ""
+	if session_method == "GET" || session_method == "DELETE" {
+		queryString = gateQuery(query)
+	} else {
+		payload, err := json.Marshal(query)
+		if err != nil {
+			return err
+		}
+		body = string(payload)
+	}
+
+	url := c.Endpoints.Rest + method
+	if queryString != "" {
+		url += "?" + queryString
+	}
+
+	now := c.Clock.Now()
+	timestamp := strconv.FormatInt(now/1000, 10)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, url, bytes.NewReader([]byte(body)))
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range GateHeaders {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("KEY", c.Key)
+	req.Header.Set("Timestamp", timestamp)
+	req.Header.Set("SIGN", c.generateSignature(session_method, method, queryString, body, timestamp))
+	if c.RecvWindow > 0 {
+		req.Header.Set("X-Gate-Exptime", strconv.FormatInt(now+c.RecvWindow.Milliseconds(), 10))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return gateDecode(resp, result)
+}
+
+// SyncTime measures the offset of the local clock from /spot/time.
+func (c *GatePrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type result struct {
+			ServerTime int64 `json:"server_time"`
+		}
+
+		resp := new(result)
+		if err := (&GatePublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "/api/v4/spot/time", "GET", resp); err != nil {
+			return 0, err
+		}
+		return resp.ServerTime, nil
+	})
+}
+
+// SetRecvWindow sets how long a request stays valid, sent as its expiration
+// time.
+func (c *GatePrivateClient) SetRecvWindow(window time.Duration) {
+	c.RecvWindow = window
+}
+
+func (c *GatePrivateClient) ApplyInitial(lot float64) error {
+	balance, err := c.GetMarginBalance()
+	if err != nil {
+		return err
+	}
+	if balance < lot {
+		return fmt.Errorf("you have not enough balance (should be greater than lot)")
+	}
+	return nil
+}
+
+type gateCrossBalance struct {
+	Available string `json:"available"`
+	Freeze    string `json:"freeze"`
+	Borrowed  string `json:"borrowed"`
+	Interest  string `json:"interest"`
+}
+
+type gateCrossAccount struct {
+	Total    string                      `json:"total"`
+	Borrowed string                      `json:"borrowed"`
+	Interest string                      `json:"interest"`
+	Balances map[string]gateCrossBalance `json:"balances"`
+}
+
+func (c *GatePrivateClient) getAccount() (*gateCrossAccount, error) {
+	resp := new(gateCrossAccount)
+	if err := c.PerformSign(map[string]interface{}{}, "/api/v4/margin/cross/accounts", "GET", resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetMarginBalance is the net value of the cross margin account in USDT.
+func (c *GatePrivateClient) GetMarginBalance() (float64, error) {
+	account, err := c.getAccount()
+	if err != nil {
+		return 0.0, err
+	}
+
+	total, _ := strconv.ParseFloat(account.Total, 64)
+	borrowed, _ := strconv.ParseFloat(account.Borrowed, 64)
+	interest, _ := strconv.ParseFloat(account.Interest, 64)
+
+	return total - borrowed - interest, nil
+}
+
+// GetBalances returns the cross margin position of every currency.
+func (c *GatePrivateClient) GetBalances() (map[string]Balance, error) {
+	account, err := c.getAccount()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]Balance)
+	for currency, a := range account.Balances {
+		b := Balance{Asset: currency}
+		b.Free, _ = strconv.ParseFloat(a.Available, 64)
+		b.Locked, _ = strconv.ParseFloat(a.Freeze, 64)
+		b.Borrowed, _ = strconv.ParseFloat(a.Borrowed, 64)
+		b.Interest, _ = strconv.ParseFloat(a.Interest, 64)
+		balances[currency] = b
+	}
+
+	return balances, nil
+}
+
+func (c *GatePrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	parameters := map[string]interface{}{
+		"currency": asset,
+		"amount":   amount.String(),
+	}
+
+	resp := make([]interface{}, 0)
+	return c.PerformSign(parameters, "/api/v4/margin/cross/repayments", "POST", &resp)
+}
+
+// GetFees returns the taker fee of the account in percent for every symbol;
+// Gate charges one rate per fee tier.
+func (c *GatePrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	type result struct {
+		Taker string `json:"taker_fee"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(map[string]interface{}{}, "/api/v4/wallet/fee", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	taker, err := strconv.ParseFloat(resp.Taker, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		fees[s.GetBaseSymbol()] = taker * 100
+	}
+
+	return fees, nil
+}
+
+// gateText is the custom order id; Gate requires the "t-" prefix.
+func gateText(clientID string) string {
+	return "t-" + clientID
+}
+
+// limitPrice walks the REST order book for the price an IOC order has to
+// reach to fill the quantity, given in the base or (quote) the quote asset.
+// It returns the price and the base quantity.
+func (c *GatePrivateClient) limitPrice(symbol MarketSymbol, side string, quantity decimal.Decimal, quote bool) (decimal.Decimal, decimal.Decimal, error) {
+	type book struct {
+		Asks [][]string `json:"asks"`
+		Bids [][]string `json:"bids"`
+	}
+
+	resp := new(book)
+	parameters := map[string]interface{}{
+		"currency_pair": symbol.GetSymbol(),
+		"limit":         100,
+	}
+	if err := (&GatePublicClient{Endpoints: c.Endpoints}).Perform(parameters, "/api/v4/spot/order_book", "GET", resp); err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+
+	raw := resp.Bids
+	if side == "BUY" {
+		raw = resp.Asks
+	}
+
+	levels := make([]PriceLevel, 0, len(raw))
+	for _, level := range raw {
+		if len(level) < 2 {
+			continue
+		}
+		price, _ := decimal.Parse(level[0])
+		qty, _ := decimal.Parse(level[1])
+		levels = append(levels, PriceLevel{Price: price, Quantity: qty})
+	}
+
+	amount := quantity.Float64()
+	for idx := range levels {
+		if quote {
+			if base, _, ok := FillQuote(levels[:idx+1], amount); ok {
+				qty := symbol.GetFilters().RoundQty(decimal.FromFloat(base).Truncate(symbol.GetBasePrecision()))
+				return levels[idx].Price, qty, nil
+			}
+		} else if _, _, ok := FillBase(levels[:idx+1], amount); ok {
+			return levels[idx].Price, quantity, nil
+		}
+	}
+
+	return decimal.Zero, decimal.Zero, fmt.Errorf("order book of %s is not deep enough for %s", symbol.GetSymbol(), quantity)
+}
+
+// PlaceOrder places a cross margin order which borrows what the account lacks
+// and repays liabilities from what it acquires. Gate sizes market buys in the
+// quote asset and market sells in the base asset, so base sized buys and
+// quote sized sells are sent as IOC limit orders at the price that fills
+// them in the current book.
+func (c *GatePrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+
+	parameters := map[string]interface{}{
+		"text":          gateText(clientID),
+		"currency_pair": symbol.GetSymbol(),
+		"account":       "cross_margin",
+		"side":          GateSides[side],
+		"time_in_force": "ioc",
+		"auto_borrow":   true,
+		"auto_repay":    true,
+	}
+
+	if (side == "BUY") == (t == "open") {
+		parameters["type"] = "market"
+		parameters["amount"] = quantity.String()
+	} else {
+		price, amount, err := c.limitPrice(symbol, side, quantity, t == "open")
+		if err != nil {
+			return nil, err
+		}
+		parameters["type"] = "limit"
+		parameters["price"] = price.String()
+		parameters["amount"] = amount.String()
+	}
+
+	resp := new(GateOrderData)
+
+	if err := c.PerformSign(parameters, "/api/v4/spot/orders", "POST", resp); err != nil {
+		return nil, err
+	}
+
+	return resp.result(), nil
+}
+
+// GetOrder looks the order up by its custom id.
+func (c *GatePrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	parameters := map[string]interface{}{
+		"currency_pair": symbol.GetSymbol(),
+		"account":       "cross_margin",
+	}
+
+	resp := new(GateOrderData)
+
+	if err := c.PerformSign(parameters, "/api/v4/spot/orders/"+gateText(clientID), "GET", resp); err != nil {
+		return nil, err
+	}
+
+	return resp.result(), nil
+}
+
+type GateOrderData struct {
+	OrderID       string `json:"id"`
+	Text          string `json:"text"`
+	Symbol        string `json:"currency_pair"`
+	Status        string `json:"status"`
+	Side          string `json:"side"`
+	Quantity      string `json:"filled_amount"`
+	QuoteQuantity string `json:"filled_total"`
+	Price         string `json:"avg_deal_price"`
+	Commission    string `json:"fee"`
+	FeeCurrency   string `json:"fee_currency"`
+	CreatedTime   int64  `json:"create_time_ms"`
+	UpdatedTime   int64  `json:"update_time_ms"`
+}
+
+// result converts the order data; the fee is charged in fee_currency, the
+// acquired asset unless it is paid with GT.
+func (d *GateOrderData) result() *OrderResult {
+	qty, _ := strconv.ParseFloat(d.Quantity, 64)
+	quote, _ := strconv.ParseFloat(d.QuoteQuantity, 64)
+	price, _ := strconv.ParseFloat(d.Price, 64)
+	commission, _ := strconv.ParseFloat(d.Commission, 64)
+
+	if qty == 0 && price > 0 {
+		qty = quote / price
+	}
+
+	return &OrderResult{
+		OrderID:       d.OrderID,
+		ClientOrderID: strings.TrimPrefix(d.Text, "t-"),
+		Symbol:        d.Symbol,
+		Side:          strings.ToUpper(d.Side),
+		Status:        d.Status,
+		ExecutedQty:   qty,
+		QuoteQty:      quote,
+		AvgPrice:      price,
+		Fees:          map[string]float64{d.FeeCurrency: commission},
+		CreatedAt:     time.UnixMilli(d.CreatedTime),
+		UpdatedAt:     time.UnixMilli(d.UpdatedTime),
+	}
+}
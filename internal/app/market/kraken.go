@@ -0,0 +1,1004 @@
+package market
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"tarbitrage/pkg/decimal"
+	"tarbitrage/pkg/websocket"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type KrakenPublicClient struct {
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
+}
+
+type KrakenPrivateClient struct {
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Logger     *logrus.Logger
+	Clock      Clock
+	RecvWindow time.Duration
+	nonce      int64
+}
+
+var KrakenHeaders = map[string]string{
+	"Accept": "application/json",
+}
+
+var KrakenSides = map[string]string{
+	"BUY":  "buy",
+	"SELL": "sell",
+}
+
+// KrakenAssets maps the legacy asset codes of the REST API to the common
+// names used by the triangle files and the v2 WebSocket API.
+var KrakenAssets = map[string]string{
+	"XBT":  "BTC",
+	"XXBT": "BTC",
+	"XDG":  "DOGE",
+	"XXDG": "DOGE",
+	"XETH": "ETH",
+	"XXRP": "XRP",
+	"XLTC": "LTC",
+	"XXLM": "XLM",
+	"XETC": "ETC",
+	"XXMR": "XMR",
+	"XZEC": "ZEC",
+	"XMLN": "MLN",
+	"XREP": "REP",
+	"ZUSD": "USD",
+	"ZEUR": "EUR",
+	"ZGBP": "GBP",
+	"ZCAD": "CAD",
+	"ZJPY": "JPY",
+	"ZAUD": "AUD",
+	"ZCHF": "CHF",
+}
+
+// NormalizeKrakenAsset returns the common name of a Kraken asset code.
+func NormalizeKrakenAsset(asset string) string {
+	if name, ok := KrakenAssets[asset]; ok {
+		return name
+	}
+	return asset
+}
+
+// krakenAsset returns the code Kraken uses in pair names for a common asset
+// name, e.g. XBT for BTC.
+func krakenAsset(asset string) string {
+	switch asset {
+	case "BTC":
+		return "XBT"
+	case "DOGE":
+		return "XDG"
+	}
+	return asset
+}
+
+// KrakenSymbol keeps the assets under their common names; Symbol is the REST
+// pair name, e.g. XBTUSDT, and WsSymbol the v2 WebSocket one, e.g. BTC/USDT.
+type KrakenSymbol struct {
+	BaseAsset      string
+	QuoteAsset     string
+	Symbol         string
+	WsSymbol       string
+	Pair           string
+	BaseSymbol     string
+	BasePrecision  int
+	PricePrecision int
+	Filters        SymbolFilters
+}
+
+func (s *KrakenSymbol) GetBaseAsset() string {
+	return s.BaseAsset
+}
+
+func (s *KrakenSymbol) GetQuoteAsset() string {
+	return s.QuoteAsset
+}
+
+func (s *KrakenSymbol) GetBaseSymbol() string {
+	return s.BaseSymbol
+}
+
+func (s *KrakenSymbol) GetSymbol() string {
+	return s.Symbol
+}
+
+func (s *KrakenSymbol) GetBasePrecision() int {
+	return s.BasePrecision
+}
+
+func (s *KrakenSymbol) GetPricePrecision() int {
+	return s.PricePrecision
+}
+
+func (s *KrakenSymbol) SetBasePrecision(prec int) {
+	s.BasePrecision = prec
+}
+
+func (s *KrakenSymbol) SetPricePrecision(prec int) {
+	s.PricePrecision = prec
+}
+
+func (s *KrakenSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *KrakenSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
+func (c *KrakenPublicClient) Name() string {
+	return c.name
+}
+
+// SetHeartbeat sets the interval of application-level pings, zero disables them.
+func (c *KrakenPublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
+func (c *KrakenPrivateClient) Name() string {
+	return c.name
+}
+
+func (c *KrakenPrivateClient) GetKey() string {
+	return c.Key
+}
+
+func (c *KrakenPrivateClient) GetSecret() string {
+	return c.Secret
+}
+
+// SupportsShort is false: spot orders on Kraken never borrow, so an asset
+// which is not held cannot be sold.
+func (c *KrakenPrivateClient) SupportsShort() bool {
+	return false
+}
+
+// CreateSymbol accepts both common and Kraken asset names, so "BTC+USDT" and
+// "XBT+USDT" are the same symbol.
+func (c *KrakenPublicClient) CreateSymbol(base_symbol string) MarketSymbol {
+	assets := strings.Split(base_symbol, "+")
+	base, quote := NormalizeKrakenAsset(assets[0]), NormalizeKrakenAsset(assets[1])
+	return &KrakenSymbol{
+		BaseAsset:  base,
+		QuoteAsset: quote,
+		Symbol:     krakenAsset(base) + krakenAsset(quote),
+		WsSymbol:   base + "/" + quote,
+		BaseSymbol: base + "+" + quote,
+	}
+}
+
+// KrakenMaxTopics is the number of symbols subscribed over a single connection
+// and KrakenMaxArgs the number of symbols a single subscribe request may carry.
+var KrakenMaxTopics = 200
+var KrakenMaxArgs = 50
+
+// KrakenChecksumDepth is the number of levels per side the book checksum
+// covers.
+var KrakenChecksumDepth = 10
+
+// RunOrderBookStreams subscribes the symbols to the book channel; levels must
+// be 10, 25, 100, 500 or 1000.
+func (c *KrakenPublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
+
+	depth, _ := strconv.Atoi(levels)
+	switch depth {
+	case 10, 25, 100, 500, 1000:
+	default:
+		depth = 10
+	}
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, KrakenMaxTopics) {
+		books := make([]*krakenBook, len(group))
+		for i, symbol := range group {
+			books[i] = &krakenBook{
+				client:  c,
+				symbol:  symbol,
+				depth:   depth,
+				local:   NewLocalOrderBook(),
+				handler: handler,
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, depth, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
+	}
+
+	return streams, nil
+}
+
+// krakenLevel keeps the numbers as sent, they are formatted for the checksum.
+type krakenLevel struct {
+	Price    json.Number `json:"price"`
+	Quantity json.Number `json:"qty"`
+}
+
+type krakenBookData struct {
+	Symbol    string        `json:"symbol"`
+	Asks      []krakenLevel `json:"asks"`
+	Bids      []krakenLevel `json:"bids"`
+	Checksum  uint32        `json:"checksum"`
+	Timestamp string        `json:"timestamp"`
+}
+
+type krakenEvent struct {
+	Method  string           `json:"method"`
+	Success *bool            `json:"success"`
+	Error   string           `json:"error"`
+	Channel string           `json:"channel"`
+	Type    string           `json:"type"`
+	Data    []krakenBookData `json:"data"`
+}
+
+func krakenSubscribe(ws *websocket.WebSocketApp, method string, symbols []string, depth int) {
+	for i := 0; i < len(symbols); i += KrakenMaxArgs {
+		j := i + KrakenMaxArgs
+		if j > len(symbols) {
+			j = len(symbols)
+		}
+		params := map[string]interface{}{
+			"channel": "book",
+			"symbol":  symbols[i:j],
+			"depth":   depth,
+		}
+		if method == "subscribe" {
+			params["snapshot"] = true
+		}
+		ws.Send(map[string]interface{}{
+			"method": method,
+			"params": params,
+		})
+	}
+}
+
+func (c *KrakenPublicClient) runDepthConnection(id int, books []*krakenBook, depth int,
+	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+
+	endpoint := c.Endpoints.Ws
+	wsApp := new(websocket.WebSocketApp)
+
+	bySymbol := make(map[string]*krakenBook, len(books))
+	symbols := make([]string, len(books))
+	for idx, book := range books {
+		ws_symbol := book.symbol.(*KrakenSymbol).WsSymbol
+		bySymbol[ws_symbol] = book
+		symbols[idx] = ws_symbol
+	}
+
+	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.local.Reset()
+			book.handler(StaleEvent(book.symbol.GetBaseSymbol()))
+		}
+		krakenSubscribe(ws, "subscribe", symbols, depth)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
+	}
+	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
+		e := new(krakenEvent)
+		err := json.Unmarshal(message, e)
+
+		if err != nil {
+			errHandler(err)
+			return
+		}
+
+		if e.Success != nil && !*e.Success {
+			errHandler(fmt.Errorf("kraken error: method: %s, message: %s", e.Method, e.Error))
+			return
+		}
+
+		if e.Channel != "book" {
+			return
+		}
+
+		for idx := range e.Data {
+			book, ok := bySymbol[e.Data[idx].Symbol]
+			if !ok {
+				continue
+			}
+			book.process(ws, e.Type, &e.Data[idx])
+		}
+	}
+	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
+		c.Logger.Log(logrus.InfoLevel, err)
+	}
+	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
+		}
+	}
+	wsApp.Heartbeat = c.Heartbeat
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		ping := map[string]interface{}{
+			"method": "ping",
+		}
+		if err := ws.Send(ping); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
+		}
+	}
+
+	if err := wsApp.Run(endpoint, false, 0); err != nil {
+		return nil, err
+	}
+
+	return wsApp, nil
+}
+
+type krakenBook struct {
+	client  *KrakenPublicClient
+	symbol  MarketSymbol
+	depth   int
+	local   *LocalOrderBook
+	handler OrderBookHandler
+}
+
+// krakenNumber returns the plain decimal representation of a number, which
+// may be sent in exponent notation.
+func krakenNumber(n json.Number) string {
+	str := n.String()
+	if strings.ContainsAny(str, "eE") {
+		if f, err := strconv.ParseFloat(str, 64); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+	}
+	return str
+}
+
+func krakenLevels(levels []krakenLevel) [][]string {
+	res := make([][]string, len(levels))
+	for idx, level := range levels {
+		res[idx] = []string{krakenNumber(level.Price), krakenNumber(level.Quantity)}
+	}
+	return res
+}
+
+// krakenChecksumValue formats the value with the given number of decimals and
+// drops the decimal point and the leading zeros.
+func krakenChecksumValue(value decimal.Decimal, places int) string {
+	str := value.Truncate(places).String()
+	integer, fraction := str, ""
+	if dot := strings.IndexByte(str, '.'); dot >= 0 {
+		integer, fraction = str[:dot], str[dot+1:]
+	}
+	if pad := places - len(fraction); pad > 0 {
+		fraction += strings.Repeat("0", pad)
+	}
+	return strings.TrimLeft(integer+fraction, "0")
+}
+
+// checksum is the CRC32 of the best KrakenChecksumDepth asks followed by as
+// many bids, each level as price and quantity in the pair precision.
+func (b *krakenBook) checksum() uint32 {
+	var str strings.Builder
+	write := func(levels []PriceLevel) {
+		for idx, level := range levels {
+			if idx == KrakenChecksumDepth {
+				break
+			}
+			str.WriteString(krakenChecksumValue(level.Price, b.symbol.GetPricePrecision()))
+			str.WriteString(krakenChecksumValue(level.Quantity, b.symbol.GetBasePrecision()))
+		}
+	}
+	write(b.local.Asks)
+	write(b.local.Bids)
+	return crc32.ChecksumIEEE([]byte(str.String()))
+}
+
+// process applies a snapshot or an update, drops the levels beyond the
+// subscribed depth and verifies the checksum; on a mismatch the book is
+// subscribed again for a new snapshot.
+func (b *krakenBook) process(ws *websocket.WebSocketApp, t string, data *krakenBookData) {
+	switch t {
+	case "snapshot":
+		b.local.ApplySnapshot(krakenLevels(data.Asks), krakenLevels(data.Bids))
+	case "update":
+		if b.local.IsEmpty() {
+			// waiting for a snapshot after a checksum mismatch
+			return
+		}
+		b.local.ApplyDelta(krakenLevels(data.Asks), krakenLevels(data.Bids))
+	default:
+		return
+	}
+
+	if len(b.local.Asks) > b.depth {
+		b.local.Asks = b.local.Asks[:b.depth]
+	}
+	if len(b.local.Bids) > b.depth {
+		b.local.Bids = b.local.Bids[:b.depth]
+	}
+
+	if checksum := b.checksum(); checksum != data.Checksum {
+		b.client.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s %s: checksum mismatch (%d != %d), resubscribing.\n",
+			b.client.Name(), b.symbol.GetBaseSymbol(), checksum, data.Checksum))
+		b.local.Reset()
+		b.handler(StaleEvent(b.symbol.GetBaseSymbol()))
+		ws_symbol := []string{b.symbol.(*KrakenSymbol).WsSymbol}
+		krakenSubscribe(ws, "unsubscribe", ws_symbol, b.depth)
+		krakenSubscribe(ws, "subscribe", ws_symbol, b.depth)
+		return
+	}
+
+	if ts, err := time.Parse(time.RFC3339Nano, data.Timestamp); err == nil {
+		b.local.EventTime = ts
+	}
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
+type krakenPairData struct {
+	Altname   string        `json:"altname"`
+	WsName    string        `json:"wsname"`
+	PriceDec  int           `json:"pair_decimals"`
+	LotDec    int           `json:"lot_decimals"`
+	OrderMin  string        `json:"ordermin"`
+	CostMin   string        `json:"costmin"`
+	TickSize  string        `json:"tick_size"`
+	Status    string        `json:"status"`
+	LeverageB []interface{} `json:"leverage_buy"`
+}
+
+func (c *KrakenPublicClient) getAssetPairs() (map[string]krakenPairData, error) {
+	type response struct {
+		Error  []string                  `json:"error"`
+		Result map[string]krakenPairData `json:"result"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(map[string]interface{}{}, "/0/public/AssetPairs", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(resp.Error, ", "))
+	}
+
+	return resp.Result, nil
+}
+
+func (c *KrakenPublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
+	pairs, err := c.getAssetPairs()
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]string, 2*len(pairs))
+	for pair, data := range pairs {
+		byName[data.Altname] = pair
+		byName[data.WsName] = pair
+	}
+
+	for _, s := range symbols {
+		symbol := s.(*KrakenSymbol)
+		pair, ok := byName[symbol.Symbol]
+		if !ok {
+			pair, ok = byName[krakenAsset(symbol.BaseAsset)+"/"+krakenAsset(symbol.QuoteAsset)]
+		}
+		if !ok {
+			return fmt.Errorf("can't find precision information for symbol %s", s.GetBaseSymbol())
+		}
+		data := pairs[pair]
+		symbol.Pair = pair
+		symbol.Symbol = data.Altname
+
+		s.SetBasePrecision(data.LotDec)
+		s.SetPricePrecision(data.PriceDec)
+
+		filters := SymbolFilters{}
+		filters.StepSize = decimal.New(1, int32(data.LotDec))
+		filters.MinQty, _ = decimal.Parse(data.OrderMin)
+		filters.MinNotional, _ = decimal.Parse(data.CostMin)
+		filters.TickSize, _ = decimal.Parse(data.TickSize)
+		s.SetFilters(filters)
+	}
+
+	return nil
+}
+
+func (c *KrakenPublicClient) GetSpotInstruments() ([]Instrument, error) {
+	pairs, err := c.getAssetPairs()
+	if err != nil {
+		return nil, err
+	}
+
+	type ticker struct {
+		Last   []string `json:"c"`
+		Volume []string `json:"v"`
+	}
+
+	type tickersResponse struct {
+		Error  []string          `json:"error"`
+		Result map[string]ticker `json:"result"`
+	}
+
+	tickers := new(tickersResponse)
+
+	if err := c.Perform(map[string]interface{}{}, "/0/public/Ticker", "GET", tickers); err != nil {
+		return nil, err
+	}
+
+	if len(tickers.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(tickers.Error, ", "))
+	}
+
+	instruments := make([]Instrument, 0, len(pairs))
+	for pair, data := range pairs {
+		assets := strings.Split(data.WsName, "/")
+		if data.Status != "online" || len(assets) != 2 {
+			continue
+		}
+		price, volume := 0.0, 0.0
+		if t, ok := tickers.Result[pair]; ok && len(t.Last) > 0 && len(t.Volume) > 1 {
+			price, _ = strconv.ParseFloat(t.Last[0], 64)
+			volume, _ = strconv.ParseFloat(t.Volume[1], 64)
+		}
+		instruments = append(instruments, Instrument{
+			BaseAsset:   NormalizeKrakenAsset(assets[0]),
+			QuoteAsset:  NormalizeKrakenAsset(assets[1]),
+			Margin:      len(data.LeverageB) > 0,
+			LastPrice:   price,
+			QuoteVolume: volume * price,
+		})
+	}
+
+	return instruments, nil
+}
+
+func (c *KrakenPublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	values := url.Values{}
+	for k, v := range query {
+		if v != nil {
+			values.Set(k, fmt.Sprintf("%v", v))
+		}
+	}
+
+	endpoint := c.Endpoints.Rest + method
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, endpoint, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range KrakenHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// nextNonce returns a strictly increasing nonce based on the time in
+// microseconds.
+func (c *KrakenPrivateClient) nextNonce() int64 {
+	for {
+		last := atomic.LoadInt64(&c.nonce)
+		next := time.Now().UnixMicro()
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&c.nonce, last, next) {
+			return next
+		}
+	}
+}
+
+// generateSignature signs the path followed by SHA256(nonce + post data) with
+// the base64-decoded secret using HMAC-SHA512.
+func (c *KrakenPrivateClient) generateSignature(path, nonce, postData string) (string, error) {
+	secret, err := base64.StdEncoding.DecodeString(c.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	sha := sha256.Sum256([]byte(nonce + postData))
+
+	h := hmac.New(sha512.New, secret)
+	h.Write(append([]byte(path), sha[:]...))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// PerformSign posts the form encoded parameters with a fresh nonce.
+func (c *KrakenPrivateClient) PerformSign(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	nonce := strconv.FormatInt(c.nextNonce(), 10)
+
+	values := url.Values{}
+	for k, v := range query {
+		if v != nil {
+			values.Set(k, fmt.Sprintf("%v", v))
+		}
+	}
+	values.Set("nonce", nonce)
+	postData := values.Encode()
+
+	signature, err := c.generateSignature(method, nonce, postData)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, c.Endpoints.Rest+method, strings.NewReader(postData))
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range KrakenHeaders {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("API-Key", c.Key)
+	req.Header.Set("API-Sign", signature)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SyncTime measures the offset of the local clock from /0/public/Time, which
+// has a resolution of a second.
+func (c *KrakenPrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type server struct {
+			Time int64 `json:"unixtime"`
+		}
+
+		type result struct {
+			Error  []string `json:"error"`
+			Result server   `json:"result"`
+		}
+
+		resp := new(result)
+		if err := (&KrakenPublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "/0/public/Time", "GET", resp); err != nil {
+			return 0, err
+		}
+		if len(resp.Error) > 0 {
+			return 0, fmt.Errorf("kraken error: %s", strings.Join(resp.Error, ", "))
+		}
+		return resp.Result.Time * 1000, nil
+	})
+}
+
+// SetRecvWindow sets how long an order stays valid, sent as its deadline.
+func (c *KrakenPrivateClient) SetRecvWindow(window time.Duration) {
+	c.RecvWindow = window
+}
+
+func (c *KrakenPrivateClient) ApplyInitial(lot float64) error {
+	balance, err := c.GetMarginBalance()
+	if err != nil {
+		return err
+	}
+	if balance < lot {
+		return fmt.Errorf("you have not enough balance (should be greater than lot)")
+	}
+	return nil
+}
+
+// GetMarginBalance is the equivalent balance of the account in USD.
+func (c *KrakenPrivateClient) GetMarginBalance() (float64, error) {
+	parameters := map[string]interface{}{
+		"asset": "ZUSD",
+	}
+
+	type balance struct {
+		Equivalent string `json:"eb"`
+	}
+
+	type result struct {
+		Error  []string `json:"error"`
+		Result balance  `json:"result"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/0/private/TradeBalance", "POST", resp); err != nil {
+		return 0.0, err
+	}
+	if len(resp.Error) > 0 {
+		return 0.0, fmt.Errorf("kraken error: %s", strings.Join(resp.Error, ", "))
+	}
+
+	available, _ := strconv.ParseFloat(resp.Result.Equivalent, 64)
+
+	return available, nil
+}
+
+// GetBalances returns the spot balance of every asset under its common name;
+// the amount held by open orders is reported as locked.
+func (c *KrakenPrivateClient) GetBalances() (map[string]Balance, error) {
+	type asset struct {
+		Balance string `json:"balance"`
+		Hold    string `json:"hold_trade"`
+	}
+
+	type result struct {
+		Error  []string         `json:"error"`
+		Result map[string]asset `json:"result"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(map[string]interface{}{}, "/0/private/BalanceEx", "POST", resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(resp.Error, ", "))
+	}
+
+	balances := make(map[string]Balance)
+	for code, a := range resp.Result {
+		name := NormalizeKrakenAsset(code)
+		total, _ := strconv.ParseFloat(a.Balance, 64)
+		b := Balance{Asset: name}
+		b.Locked, _ = strconv.ParseFloat(a.Hold, 64)
+		b.Free = total - b.Locked
+		balances[name] = b
+	}
+
+	return balances, nil
+}
+
+// Repay is a no-op: spot orders on Kraken never borrow, so there are no
+// liabilities to repay.
+func (c *KrakenPrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	return nil
+}
+
+// GetFees returns the taker fee per base symbol; Kraken reports it in percent.
+func (c *KrakenPrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	pairs := make([]string, 0, len(symbols))
+	for _, s := range symbols {
+		pairs = append(pairs, s.GetSymbol())
+	}
+	sort.Strings(pairs)
+
+	parameters := map[string]interface{}{
+		"pair": strings.Join(pairs, ","),
+	}
+
+	type fee struct {
+		Fee string `json:"fee"`
+	}
+
+	type volume struct {
+		Fees map[string]fee `json:"fees"`
+	}
+
+	type result struct {
+		Error  []string `json:"error"`
+		Result volume   `json:"result"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/0/private/TradeVolume", "POST", resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Error) > 0 {
+		return nil, fmt.Errorf("kraken error: %s", strings.Join(resp.Error, ", "))
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		f, ok := resp.Result.Fees[s.GetSymbol()]
+		if !ok {
+			if symbol, isKraken := s.(*KrakenSymbol); isKraken {
+				f, ok = resp.Result.Fees[symbol.Pair]
+			}
+		}
+		if !ok {
+			continue
+		}
+		if rate, err := strconv.ParseFloat(f.Fee, 64); err == nil {
+			fees[s.GetBaseSymbol()] = rate
+		}
+	}
+
+	return fees, nil
+}
+
+// PlaceOrder places a spot market order. The volume of "open" orders is in
+// the quote asset (viqc); the order is rejected after RecvWindow.
+func (c *KrakenPrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+
+	parameters := map[string]interface{}{
+		"pair":      symbol.GetSymbol(),
+		"type":      KrakenSides[side],
+		"ordertype": "market",
+		"volume":    quantity.String(),
+		"cl_ord_id": clientID,
+	}
+
+	if t == "open" {
+		parameters["oflags"] = "viqc"
+	}
+
+	if c.RecvWindow > 0 {
+		deadline := time.UnixMilli(c.Clock.Now()).Add(c.RecvWindow)
+		parameters["deadline"] = deadline.UTC().Format(time.RFC3339Nano)
+	}
+
+	type result struct {
+		TxIDs []string `json:"txid"`
+	}
+
+	type response struct {
+		Error  []string `json:"error"`
+		Result result   `json:"result"`
+	}
+
+	resp := new(response)
+
+	if err := c.PerformSign(parameters, "/0/private/AddOrder", "POST", resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Error) > 0 || len(resp.Result.TxIDs) == 0 {
+		return nil, fmt.Errorf("kraken error while creating order: %s", strings.Join(resp.Error, ", "))
+	}
+
+	type query struct {
+		Error  []string                   `json:"error"`
+		Result map[string]KrakenOrderData `json:"result"`
+	}
+
+	orders := new(query)
+
+	if err := c.PerformSign(map[string]interface{}{"txid": resp.Result.TxIDs[0]}, "/0/private/QueryOrders", "POST", orders); err != nil {
+		return nil, err
+	}
+
+	if len(orders.Error) > 0 {
+		return nil, fmt.Errorf("kraken error while fetching order data: %s", strings.Join(orders.Error, ", "))
+	}
+
+	orderData, ok := orders.Result[resp.Result.TxIDs[0]]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	return orderData.result(symbol, resp.Result.TxIDs[0]), nil
+}
+
+// GetOrder looks the order up by client id among the closed orders and then
+// the open ones.
+func (c *KrakenPrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	type orders struct {
+		Closed map[string]KrakenOrderData `json:"closed"`
+		Open   map[string]KrakenOrderData `json:"open"`
+	}
+
+	type response struct {
+		Error  []string `json:"error"`
+		Result orders   `json:"result"`
+	}
+
+	for _, method := range []string{"/0/private/ClosedOrders", "/0/private/OpenOrders"} {
+		resp := new(response)
+
+		if err := c.PerformSign(map[string]interface{}{"cl_ord_id": clientID}, method, "POST", resp); err != nil {
+			return nil, err
+		}
+
+		if len(resp.Error) > 0 {
+			return nil, fmt.Errorf("kraken error while fetching order data: %s", strings.Join(resp.Error, ", "))
+		}
+
+		for _, list := range []map[string]KrakenOrderData{resp.Result.Closed, resp.Result.Open} {
+			for txid, orderData := range list {
+				return orderData.result(symbol, txid), nil
+			}
+		}
+	}
+
+	return nil, ErrOrderNotFound
+}
+
+type KrakenOrderDescription struct {
+	Pair string `json:"pair"`
+	Type string `json:"type"`
+}
+
+type KrakenOrderData struct {
+	ClientOrderID string                 `json:"cl_ord_id"`
+	Status        string                 `json:"status"`
+	Description   KrakenOrderDescription `json:"descr"`
+	Quantity      string                 `json:"vol_exec"`
+	QuoteQuantity string                 `json:"cost"`
+	Price         string                 `json:"price"`
+	Commission    string                 `json:"fee"`
+	OpenTime      float64                `json:"opentm"`
+	CloseTime     float64                `json:"closetm"`
+}
+
+// result converts the order data; fees are charged in the quote asset.
+func (d *KrakenOrderData) result(symbol MarketSymbol, txid string) *OrderResult {
+	qty, _ := strconv.ParseFloat(d.Quantity, 64)
+	quote, _ := strconv.ParseFloat(d.QuoteQuantity, 64)
+	price, _ := strconv.ParseFloat(d.Price, 64)
+	commission, _ := strconv.ParseFloat(d.Commission, 64)
+
+	updated := d.CloseTime
+	if updated == 0 {
+		updated = d.OpenTime
+	}
+
+	return &OrderResult{
+		OrderID:       txid,
+		ClientOrderID: d.ClientOrderID,
+		Symbol:        symbol.GetSymbol(),
+		Side:          strings.ToUpper(d.Description.Type),
+		Status:        d.Status,
+		ExecutedQty:   qty,
+		QuoteQty:      quote,
+		AvgPrice:      price,
+		Fees:          map[string]float64{symbol.GetQuoteAsset(): commission},
+		CreatedAt:     time.UnixMilli(int64(d.OpenTime * 1000)),
+		UpdatedAt:     time.UnixMilli(int64(updated * 1000)),
+	}
+}
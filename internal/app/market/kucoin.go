@@ -0,0 +1,909 @@
+package market
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"tarbitrage/pkg/decimal"
+	"tarbitrage/pkg/websocket"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type KucoinPublicClient struct {
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
+}
+
+type KucoinPrivateClient struct {
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Passphrase string
+	Logger     *logrus.Logger
+	Clock      Clock
+}
+
+var KucoinHeaders = map[string]string{
+	"Content-Type": "application/json",
+}
+
+var KucoinSides = map[string]string{
+	"BUY":  "buy",
+	"SELL": "sell",
+}
+
+type KucoinSymbol struct {
+	BaseAsset      string
+	QuoteAsset     string
+	Symbol         string
+	BaseSymbol     string
+	BasePrecision  int
+	PricePrecision int
+	Filters        SymbolFilters
+}
+
+func (s *KucoinSymbol) GetBaseAsset() string {
+	return s.BaseAsset
+}
+
+func (s *KucoinSymbol) GetQuoteAsset() string {
+	return s.QuoteAsset
+}
+
+func (s *KucoinSymbol) GetBaseSymbol() string {
+	return s.BaseSymbol
+}
+
+func (s *KucoinSymbol) GetSymbol() string {
+	return s.Symbol
+}
+
+func (s *KucoinSymbol) GetBasePrecision() int {
+	return s.BasePrecision
+}
+
+func (s *KucoinSymbol) GetPricePrecision() int {
+	return s.PricePrecision
+}
+
+func (s *KucoinSymbol) SetBasePrecision(prec int) {
+	s.BasePrecision = prec
+}
+
+func (s *KucoinSymbol) SetPricePrecision(prec int) {
+	s.PricePrecision = prec
+}
+
+func (s *KucoinSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *KucoinSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
+func (c *KucoinPublicClient) Name() string {
+	return c.name
+}
+
+// SetHeartbeat sets the interval of application-level pings; zero keeps the
+// interval the server mandates when the connection is bootstrapped.
+func (c *KucoinPublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
+func (c *KucoinPrivateClient) Name() string {
+	return c.name
+}
+
+func (c *KucoinPrivateClient) GetKey() string {
+	return c.Key
+}
+
+func (c *KucoinPrivateClient) GetSecret() string {
+	return c.Secret
+}
+
+// SupportsShort is true, orders borrow on the cross margin account.
+func (c *KucoinPrivateClient) SupportsShort() bool {
+	return true
+}
+
+// CreateSymbol maps "ETH+BTC" to the symbol "ETH-BTC".
+func (c *KucoinPublicClient) CreateSymbol(base_symbol string) MarketSymbol {
+	assets := strings.Split(base_symbol, "+")
+	return &KucoinSymbol{
+		BaseAsset:  assets[0],
+		QuoteAsset: assets[1],
+		Symbol:     assets[0] + "-" + assets[1],
+		BaseSymbol: base_symbol,
+	}
+}
+
+// KucoinMaxTopics is the number of symbols subscribed over a single
+// connection and KucoinMaxArgs the number of symbols a single topic may carry.
+var KucoinMaxTopics = 300
+var KucoinMaxArgs = 100
+
+// RunOrderBookStreams subscribes the symbols to the 5 best levels topic, the
+// only depth supported.
+func (c *KucoinPublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, KucoinMaxTopics) {
+		books := make([]*kucoinBook, len(group))
+		for i, symbol := range group {
+			books[i] = &kucoinBook{
+				symbol:  symbol,
+				local:   NewLocalOrderBook(),
+				handler: handler,
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
+	}
+
+	return streams, nil
+}
+
+type kucoinBookData struct {
+	Asks      [][]string `json:"asks"`
+	Bids      [][]string `json:"bids"`
+	Timestamp int64      `json:"timestamp"`
+}
+
+type kucoinEvent struct {
+	ID    string          `json:"id"`
+	Type  string          `json:"type"`
+	Topic string          `json:"topic"`
+	Code  json.Number     `json:"code"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// bullet obtains a connection token and the server the public WebSocket
+// connects to, along with the ping interval the server expects.
+func (c *KucoinPublicClient) bullet() (string, time.Duration, error) {
+	type server struct {
+		Endpoint     string `json:"endpoint"`
+		PingInterval int64  `json:"pingInterval"`
+	}
+
+	type data struct {
+		Token   string   `json:"token"`
+		Servers []server `json:"instanceServers"`
+	}
+
+	type response struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+		Data    data   `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v1/bullet-public", "POST", resp); err != nil {
+		return "", 0, err
+	}
+
+	if resp.Code != "200000" {
+		return "", 0, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	if len(resp.Data.Servers) == 0 {
+		return "", 0, fmt.Errorf("kucoin error: no websocket servers")
+	}
+
+	instance := resp.Data.Servers[0]
+	endpoint := fmt.Sprintf("%s?token=%s&connectId=%d", instance.Endpoint, resp.Data.Token, time.Now().UnixNano())
+
+	return endpoint, time.Duration(instance.PingInterval) * time.Millisecond, nil
+}
+
+func kucoinSubscribe(ws *websocket.WebSocketApp, t string, symbols []string) {
+	for i := 0; i < len(symbols); i += KucoinMaxArgs {
+		j := i + KucoinMaxArgs
+		if j > len(symbols) {
+			j = len(symbols)
+		}
+		subscription := map[string]interface{}{
+			"id":             strconv.FormatInt(time.Now().UnixNano(), 10),
+			"type":           t,
+			"topic":          "/spotMarket/level2Depth5:" + strings.Join(symbols[i:j], ","),
+			"privateChannel": false,
+			"response":       true,
+		}
+		ws.Send(subscription)
+	}
+}
+
+// runDepthConnection dials a server obtained from the bullet endpoint; the
+// token is requested again on every reconnection as it is valid for a single
+// connection.
+func (c *KucoinPublicClient) runDepthConnection(id int, books []*kucoinBook,
+	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+
+	wsApp := new(websocket.WebSocketApp)
+
+	byTopic := make(map[string]*kucoinBook, len(books))
+	symbols := make([]string, len(books))
+	for idx, book := range books {
+		byTopic["/spotMarket/level2Depth5:"+book.symbol.GetSymbol()] = book
+		symbols[idx] = book.symbol.GetSymbol()
+	}
+
+	wsApp.Resolve = func(ws *websocket.WebSocketApp) (string, error) {
+		endpoint, interval, err := c.bullet()
+		if err != nil {
+			return "", err
+		}
+		ws.Heartbeat = c.Heartbeat
+		if ws.Heartbeat <= 0 {
+			ws.Heartbeat = interval
+		}
+		return endpoint, nil
+	}
+	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.local.Reset()
+			book.handler(StaleEvent(book.symbol.GetBaseSymbol()))
+		}
+		kucoinSubscribe(ws, "subscribe", symbols)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
+	}
+	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
+		e := new(kucoinEvent)
+		err := json.Unmarshal(message, e)
+
+		if err != nil {
+			errHandler(err)
+			return
+		}
+
+		switch e.Type {
+		case "error":
+			errHandler(fmt.Errorf("kucoin error: code: %s, message: %s", e.Code, string(e.Data)))
+			return
+		case "message":
+		default:
+			return
+		}
+
+		book, ok := byTopic[e.Topic]
+		if !ok {
+			return
+		}
+
+		data := new(kucoinBookData)
+		if err := json.Unmarshal(e.Data, data); err != nil {
+			errHandler(err)
+			return
+		}
+
+		book.process(data)
+	}
+	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
+		c.Logger.Log(logrus.InfoLevel, err)
+	}
+	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
+		}
+	}
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		ping := map[string]interface{}{
+			"id":   strconv.FormatInt(time.Now().UnixNano(), 10),
+			"type": "ping",
+		}
+		if err := ws.Send(ping); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
+		}
+	}
+
+	if err := wsApp.Run("", false, 0); err != nil {
+		return nil, err
+	}
+
+	return wsApp, nil
+}
+
+type kucoinBook struct {
+	symbol  MarketSymbol
+	local   *LocalOrderBook
+	handler OrderBookHandler
+}
+
+// process replaces the book, every level2Depth5 message is a snapshot.
+func (b *kucoinBook) process(data *kucoinBookData) {
+	if len(data.Asks) == 0 {
+		return
+	}
+
+	b.local.ApplySnapshot(data.Asks, data.Bids)
+	b.local.EventTime = time.UnixMilli(data.Timestamp)
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
+type kucoinSymbolData struct {
+	Symbol         string `json:"symbol"`
+	BaseAsset      string `json:"baseCurrency"`
+	QuoteAsset     string `json:"quoteCurrency"`
+	BaseMinSize    string `json:"baseMinSize"`
+	BaseMaxSize    string `json:"baseMaxSize"`
+	QuoteMinSize   string `json:"quoteMinSize"`
+	QuoteMaxSize   string `json:"quoteMaxSize"`
+	BaseIncrement  string `json:"baseIncrement"`
+	PriceIncrement string `json:"priceIncrement"`
+	EnableTrading  bool   `json:"enableTrading"`
+	Margin         bool   `json:"isMarginEnabled"`
+}
+
+func (c *KucoinPublicClient) getSymbols() ([]kucoinSymbolData, error) {
+	type response struct {
+		Code    string             `json:"code"`
+		Message string             `json:"msg"`
+		Data    []kucoinSymbolData `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v2/symbols", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != "200000" {
+		return nil, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	return resp.Data, nil
+}
+
+func (c *KucoinPublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
+	list, err := c.getSymbols()
+	if err != nil {
+		return err
+	}
+
+	bySymbol := make(map[string]kucoinSymbolData, len(list))
+	for _, data := range list {
+		bySymbol[data.Symbol] = data
+	}
+
+	for _, s := range symbols {
+		data, ok := bySymbol[s.GetSymbol()]
+		if !ok {
+			return fmt.Errorf("can't find precision information for symbol %s", s.GetBaseSymbol())
+		}
+		s.SetBasePrecision(GetPrecision(data.BaseIncrement))
+		s.SetPricePrecision(GetPrecision(data.PriceIncrement))
+
+		filters := SymbolFilters{}
+		filters.StepSize, _ = decimal.Parse(data.BaseIncrement)
+		filters.MinQty, _ = decimal.Parse(data.BaseMinSize)
+		filters.MaxQty, _ = decimal.Parse(data.BaseMaxSize)
+		filters.MinNotional, _ = decimal.Parse(data.QuoteMinSize)
+		filters.MaxNotional, _ = decimal.Parse(data.QuoteMaxSize)
+		filters.TickSize, _ = decimal.Parse(data.PriceIncrement)
+		s.SetFilters(filters)
+	}
+
+	return nil
+}
+
+func (c *KucoinPublicClient) GetSpotInstruments() ([]Instrument, error) {
+	list, err := c.getSymbols()
+	if err != nil {
+		return nil, err
+	}
+
+	type ticker struct {
+		Symbol    string `json:"symbol"`
+		LastPrice string `json:"last"`
+		Turnover  string `json:"volValue"`
+	}
+
+	type tickers struct {
+		Ticker []ticker `json:"ticker"`
+	}
+
+	type tickersResponse struct {
+		Code    string  `json:"code"`
+		Message string  `json:"msg"`
+		Data    tickers `json:"data"`
+	}
+
+	resp := new(tickersResponse)
+
+	if err := c.Perform(map[string]interface{}{}, "/api/v1/market/allTickers", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != "200000" {
+		return nil, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	stats := make(map[string]ticker, len(resp.Data.Ticker))
+	for _, t := range resp.Data.Ticker {
+		stats[t.Symbol] = t
+	}
+
+	instruments := make([]Instrument, 0, len(list))
+	for _, data := range list {
+		if !data.EnableTrading {
+			continue
+		}
+		price, _ := strconv.ParseFloat(stats[data.Symbol].LastPrice, 64)
+		volume, _ := strconv.ParseFloat(stats[data.Symbol].Turnover, 64)
+		instruments = append(instruments, Instrument{
+			BaseAsset:   data.BaseAsset,
+			QuoteAsset:  data.QuoteAsset,
+			Margin:      data.Margin,
+			LastPrice:   price,
+			QuoteVolume: volume,
+		})
+	}
+
+	return instruments, nil
+}
+
+// kucoinRequest builds the request path with the sorted query for GET and
+// DELETE, or the json body for other methods.
+func kucoinRequest(query map[string]interface{}, method string, session_method string) (string, string, error) {
+	if session_method != "GET" && session_method != "DELETE" {
+		if len(query) == 0 {
+			return method, "", nil
+		}
+		payload, err := json.Marshal(query)
+		if err != nil {
+			return "", "", err
+		}
+		return method, string(payload), nil
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var queryStrings []string
+	for _, k := range keys {
+		if v := query[k]; v != nil {
+			queryStrings = append(queryStrings, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	if len(queryStrings) == 0 {
+		return method, "", nil
+	}
+	return method + "?" + strings.Join(queryStrings, "&"), "", nil
+}
+
+func (c *KucoinPublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	path, body, err := kucoinRequest(query, method, session_method)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, c.Endpoints.Rest+path, bytes.NewReader([]byte(body)))
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range KucoinHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (c *KucoinPrivateClient) sign(data string) string {
+	h := hmac.New(sha256.New, []byte(c.Secret))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// PerformSign signs timestamp + method + request path + body; with a version
+// 2 key the passphrase is sent signed with the secret as well.
+func (c *KucoinPrivateClient) PerformSign(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	path, body, err := kucoinRequest(query, method, session_method)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(c.Clock.Now(), 10)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, c.Endpoints.Rest+path, bytes.NewReader([]byte(body)))
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range KucoinHeaders {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("KC-API-KEY", c.Key)
+	req.Header.Set("KC-API-SIGN", c.sign(timestamp+session_method+path+body))
+	req.Header.Set("KC-API-TIMESTAMP", timestamp)
+	req.Header.Set("KC-API-PASSPHRASE", c.sign(c.Passphrase))
+	req.Header.Set("KC-API-KEY-VERSION", "2")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SyncTime measures the offset of the local clock from /api/v1/timestamp.
+func (c *KucoinPrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type result struct {
+			Code    string `json:"code"`
+			Message string `json:"msg"`
+			Data    int64  `json:"data"`
+		}
+
+		resp := new(result)
+		if err := (&KucoinPublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "/api/v1/timestamp", "GET", resp); err != nil {
+			return 0, err
+		}
+		if resp.Code != "200000" {
+			return 0, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+		}
+		return resp.Data, nil
+	})
+}
+
+// SetRecvWindow is a no-op: KuCoin accepts requests within a fixed 5 seconds
+// of their timestamp.
+func (c *KucoinPrivateClient) SetRecvWindow(window time.Duration) {}
+
+func (c *KucoinPrivateClient) ApplyInitial(lot float64) error {
+	balance, err := c.GetMarginBalance()
+	if err != nil {
+		return err
+	}
+	if balance < lot {
+		return fmt.Errorf("you have not enough balance (should be greater than lot)")
+	}
+	return nil
+}
+
+type kucoinMarginAccount struct {
+	Currency  string `json:"currency"`
+	Total     string `json:"total"`
+	Available string `json:"available"`
+	Hold      string `json:"hold"`
+	Liability string `json:"liability"`
+	Principal string `json:"liabilityPrincipal"`
+	Interest  string `json:"liabilityInterest"`
+}
+
+type kucoinMarginAccounts struct {
+	TotalAsset     string                `json:"totalAssetOfQuoteCurrency"`
+	TotalLiability string                `json:"totalLiabilityOfQuoteCurrency"`
+	Accounts       []kucoinMarginAccount `json:"accounts"`
+}
+
+func (c *KucoinPrivateClient) getAccounts() (*kucoinMarginAccounts, error) {
+	parameters := map[string]interface{}{
+		"quoteCurrency": "USDT",
+	}
+
+	type result struct {
+		Code    string               `json:"code"`
+		Message string               `json:"msg"`
+		Data    kucoinMarginAccounts `json:"data"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/api/v3/margin/accounts", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "200000" {
+		return nil, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	return &resp.Data, nil
+}
+
+// GetMarginBalance is the net asset value of the cross margin account in
+// USDT.
+func (c *KucoinPrivateClient) GetMarginBalance() (float64, error) {
+	accounts, err := c.getAccounts()
+	if err != nil {
+		return 0.0, err
+	}
+
+	total, _ := strconv.ParseFloat(accounts.TotalAsset, 64)
+	liability, _ := strconv.ParseFloat(accounts.TotalLiability, 64)
+
+	return total - liability, nil
+}
+
+// GetBalances returns the cross margin position of every currency; the
+// liability is split into principal and interest when they are reported.
+func (c *KucoinPrivateClient) GetBalances() (map[string]Balance, error) {
+	accounts, err := c.getAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]Balance)
+	for _, a := range accounts.Accounts {
+		b := Balance{Asset: a.Currency}
+		b.Free, _ = strconv.ParseFloat(a.Available, 64)
+		b.Locked, _ = strconv.ParseFloat(a.Hold, 64)
+		if a.Principal != "" {
+			b.Borrowed, _ = strconv.ParseFloat(a.Principal, 64)
+			b.Interest, _ = strconv.ParseFloat(a.Interest, 64)
+		} else {
+			b.Borrowed, _ = strconv.ParseFloat(a.Liability, 64)
+		}
+		balances[a.Currency] = b
+	}
+
+	return balances, nil
+}
+
+func (c *KucoinPrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	parameters := map[string]interface{}{
+		"currency":   asset,
+		"size":       amount.String(),
+		"isIsolated": false,
+	}
+
+	type result struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/api/v3/margin/repay", "POST", resp); err != nil {
+		return err
+	}
+	if resp.Code != "200000" {
+		return fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	return nil
+}
+
+// KucoinMaxFeeSymbols is the number of symbols a single fee request may carry.
+var KucoinMaxFeeSymbols = 10
+
+// GetFees returns the taker fee in percent per base symbol.
+func (c *KucoinPrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	type fee struct {
+		Symbol string `json:"symbol"`
+		Taker  string `json:"takerFeeRate"`
+	}
+
+	type result struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+		Data    []fee  `json:"data"`
+	}
+
+	rates := make(map[string]float64, len(symbols))
+	for i := 0; i < len(symbols); i += KucoinMaxFeeSymbols {
+		j := i + KucoinMaxFeeSymbols
+		if j > len(symbols) {
+			j = len(symbols)
+		}
+		names := make([]string, 0, j-i)
+		for _, s := range symbols[i:j] {
+			names = append(names, s.GetSymbol())
+		}
+
+		resp := new(result)
+		if err := c.PerformSign(map[string]interface{}{"symbols": strings.Join(names, ",")}, "/api/v1/trade-fees", "GET", resp); err != nil {
+			return nil, err
+		}
+		if resp.Code != "200000" {
+			return nil, fmt.Errorf("kucoin error: code: %s, message: %s", resp.Code, resp.Message)
+		}
+
+		for _, f := range resp.Data {
+			rate, _ := strconv.ParseFloat(f.Taker, 64)
+			rates[f.Symbol] = rate * 100
+		}
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		if rate, ok := rates[s.GetSymbol()]; ok {
+			fees[s.GetBaseSymbol()] = rate
+		}
+	}
+
+	return fees, nil
+}
+
+// PlaceOrder places a cross margin market order which borrows what the
+// account lacks and repays liabilities from what it acquires. The size of
+// "open" orders is in the quote asset (funds).
+func (c *KucoinPrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+
+	parameters := map[string]interface{}{
+		"clientOid":   clientID,
+		"symbol":      symbol.GetSymbol(),
+		"side":        KucoinSides[side],
+		"type":        "market",
+		"marginModel": "cross",
+		"autoBorrow":  true,
+		"autoRepay":   true,
+	}
+
+	switch t {
+	case "open":
+		parameters["funds"] = quantity.String()
+	case "close":
+		parameters["size"] = quantity.String()
+	}
+
+	type result struct {
+		OrderID string `json:"orderId"`
+	}
+
+	type response struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+		Data    result `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.PerformSign(parameters, "/api/v1/margin/order", "POST", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != "200000" {
+		return nil, fmt.Errorf("kucoin error while creating order: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	orderData, err := c.queryOrder("/api/v1/orders/" + resp.Data.OrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return orderData.result(), nil
+}
+
+// GetOrder looks the order up by client id.
+func (c *KucoinPrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	orderData, err := c.queryOrder("/api/v1/order/client-order/" + clientID)
+	if err != nil {
+		return nil, err
+	}
+	return orderData.result(), nil
+}
+
+func (c *KucoinPrivateClient) queryOrder(method string) (*KucoinOrderData, error) {
+	type response struct {
+		Code    string           `json:"code"`
+		Message string           `json:"msg"`
+		Data    *KucoinOrderData `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.PerformSign(map[string]interface{}{}, method, "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != "200000" {
+		return nil, fmt.Errorf("kucoin error while fetching order data: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	if resp.Data == nil || resp.Data.OrderID == "" {
+		return nil, ErrOrderNotFound
+	}
+
+	return resp.Data, nil
+}
+
+type KucoinOrderData struct {
+	OrderID       string `json:"id"`
+	ClientOrderID string `json:"clientOid"`
+	Symbol        string `json:"symbol"`
+	Side          string `json:"side"`
+	Quantity      string `json:"dealSize"`
+	QuoteQuantity string `json:"dealFunds"`
+	Commission    string `json:"fee"`
+	FeeCurrency   string `json:"feeCurrency"`
+	IsActive      bool   `json:"isActive"`
+	CancelExist   bool   `json:"cancelExist"`
+	CreatedAt     int64  `json:"createdAt"`
+}
+
+// result converts the order data; the fee is charged in feeCurrency, the
+// quote asset for market orders.
+func (d *KucoinOrderData) result() *OrderResult {
+	qty, _ := strconv.ParseFloat(d.Quantity, 64)
+	quote, _ := strconv.ParseFloat(d.QuoteQuantity, 64)
+	commission, _ := strconv.ParseFloat(d.Commission, 64)
+
+	status := "done"
+	switch {
+	case d.IsActive:
+		status = "active"
+	case d.CancelExist:
+		status = "cancelled"
+	}
+
+	avg := 0.0
+	if qty > 0 {
+		avg = quote / qty
+	}
+
+	return &OrderResult{
+		OrderID:       d.OrderID,
+		ClientOrderID: d.ClientOrderID,
+		Symbol:        d.Symbol,
+		Side:          strings.ToUpper(d.Side),
+		Status:        status,
+		ExecutedQty:   qty,
+		QuoteQty:      quote,
+		AvgPrice:      avg,
+		Fees:          map[string]float64{d.FeeCurrency: commission},
+		CreatedAt:     time.UnixMilli(d.CreatedAt),
+		UpdatedAt:     time.UnixMilli(d.CreatedAt),
+	}
+}
@@ -1,9 +1,11 @@
 package market
 
 import (
+	"errors"
 	"fmt"
-	"strings"
+	"tarbitrage/pkg/decimal"
 	"tarbitrage/pkg/websocket"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,50 +13,133 @@ import (
 type PublicClient interface {
 	Name() string
 	CreateSymbol(base_symbol string) MarketSymbol
-	RunOrderBookStream(symbol MarketSymbol, levels string,
-		handler OrderBookHandler, errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error)
+	RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+		handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error)
 	GetInstrumentsInfo(symbols []MarketSymbol) error
+	GetSpotInstruments() ([]Instrument, error)
+	SetHeartbeat(interval time.Duration)
 }
 
 type PrivateClient interface {
 	Name() string
 	GetKey() string
 	GetSecret() string
+	SupportsShort() bool
 	ApplyInitial(float64) error
 	GetMarginBalance() (float64, error)
-	PlaceOrder(symbol, side, t, quantity string) (float64, error)
+	GetBalances() (map[string]Balance, error)
+	Repay(asset string, amount decimal.Decimal) error
+	GetFees(symbols []MarketSymbol) (map[string]float64, error)
+	PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error)
+	GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error)
+	SyncTime() (time.Duration, error)
+	SetRecvWindow(window time.Duration)
 }
 
-func NewPublicClient(market string, logger *logrus.Logger) (PublicClient, error) {
+// NewPublicClient creates the market data client talking to the endpoints,
+// see GetEndpoints.
+func NewPublicClient(market string, endpoints Endpoints, logger *logrus.Logger) (PublicClient, error) {
 	switch market {
 	case "BINANCE":
 		return &BinancePublicClient{
-			name:   market,
-			Logger: logger,
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
 		}, nil
 	case "BYBIT":
 		return &BybitPublicClient{
-			name:   market,
-			Logger: logger,
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
+			Heartbeat: 20 * time.Second,
+		}, nil
+	case "OKX":
+		return &OKXPublicClient{
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
+			Heartbeat: 20 * time.Second,
+		}, nil
+	case "KRAKEN":
+		return &KrakenPublicClient{
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
+		}, nil
+	case "KUCOIN":
+		return &KucoinPublicClient{
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
+		}, nil
+	case "GATE":
+		return &GatePublicClient{
+			name:      market,
+			Endpoints: endpoints,
+			Logger:    logger,
+			Heartbeat: 20 * time.Second,
 		}, nil
 	default:
 		return nil, fmt.Errorf("unsupported market: %s", market)
 	}
 }
 
-func NewPrivateClient(market, api_key, secret string) (PrivateClient, error) {
+// NewPrivateClient creates the trading client; the passphrase is only used
+// by OKX and KuCoin. Endpoints serving market data only are refused.
+func NewPrivateClient(market string, endpoints Endpoints, api_key, secret, passphrase string) (PrivateClient, error) {
+	if endpoints.PublicOnly {
+		return nil, fmt.Errorf("%s endpoints %s have no margin trading API, use them in paper mode", market, endpoints.Rest)
+	}
+
 	switch market {
 	case "BINANCE":
 		return &BinancePrivateClient{
-			name:   market,
-			Key:    api_key,
-			Secret: secret,
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			RecvWindow: DefaultRecvWindow,
 		}, nil
 	case "BYBIT":
 		return &BybitPrivateClient{
-			name:   market,
-			Key:    api_key,
-			Secret: secret,
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			RecvWindow: DefaultRecvWindow,
+		}, nil
+	case "OKX":
+		return &OKXPrivateClient{
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			Passphrase: passphrase,
+			RecvWindow: DefaultRecvWindow,
+		}, nil
+	case "KRAKEN":
+		return &KrakenPrivateClient{
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			RecvWindow: DefaultRecvWindow,
+		}, nil
+	case "KUCOIN":
+		return &KucoinPrivateClient{
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			Passphrase: passphrase,
+		}, nil
+	case "GATE":
+		return &GatePrivateClient{
+			name:       market,
+			Endpoints:  endpoints,
+			Key:        api_key,
+			Secret:     secret,
+			RecvWindow: DefaultRecvWindow,
 		}, nil
 	default:
 		return nil, fmt.Errorf("unsupported market: %s", market)
@@ -70,36 +155,213 @@ type MarketSymbol interface {
 	GetPricePrecision() int
 	SetBasePrecision(int)
 	SetPricePrecision(int)
+	GetFilters() SymbolFilters
+	SetFilters(SymbolFilters)
+}
+
+// SymbolFilters are the order limits of a symbol: quantities are in the base
+// asset and notionals in the quote asset. Zero limits are not enforced.
+type SymbolFilters struct {
+	MinQty      decimal.Decimal
+	MaxQty      decimal.Decimal
+	StepSize    decimal.Decimal
+	MinNotional decimal.Decimal
+	MaxNotional decimal.Decimal
+	TickSize    decimal.Decimal
+}
+
+// RoundQty rounds the quantity down to the step size.
+func (f SymbolFilters) RoundQty(quantity decimal.Decimal) decimal.Decimal {
+	return quantity.FloorToStep(f.StepSize)
+}
+
+// RoundPrice rounds the price down to the tick size.
+func (f SymbolFilters) RoundPrice(price decimal.Decimal) decimal.Decimal {
+	return price.FloorToStep(f.TickSize)
+}
+
+// Check validates an order of quantity base asset worth notional quote asset.
+func (f SymbolFilters) Check(quantity, notional decimal.Decimal) error {
+	switch {
+	case quantity.Equal(decimal.Max) || notional.Equal(decimal.Max):
+		return fmt.Errorf("quantity %s or notional %s is out of range", quantity, notional)
+	case f.MinQty.Sign() > 0 && quantity.Cmp(f.MinQty) < 0:
+		return fmt.Errorf("quantity %s is below the minimal %s", quantity, f.MinQty)
+	case f.MaxQty.Sign() > 0 && quantity.Cmp(f.MaxQty) > 0:
+		return fmt.Errorf("quantity %s is above the maximal %s", quantity, f.MaxQty)
+	case f.MinNotional.Sign() > 0 && notional.Cmp(f.MinNotional) < 0:
+		return fmt.Errorf("notional %s is below the minimal %s", notional, f.MinNotional)
+	case f.MaxNotional.Sign() > 0 && notional.Cmp(f.MaxNotional) > 0:
+		return fmt.Errorf("notional %s is above the maximal %s", notional, f.MaxNotional)
+	}
+	return nil
 }
 
 type PriceLevel struct {
-	Price    float64
-	Quantity float64
+	Price    decimal.Decimal
+	Quantity decimal.Decimal
 }
 
+// OrderBookEvent is a copy of the book with the exchange time of the last
+// update and the local time it has been received at.
 type OrderBookEvent struct {
-	Symbol string
-	Asks   []PriceLevel
-	Bids   []PriceLevel
+	Symbol      string
+	Asks        []PriceLevel
+	Bids        []PriceLevel
+	Stale       bool
+	EventTime   time.Time
+	ReceiveTime time.Time
 }
 
 type OrderBookHandler func(event *OrderBookEvent)
 
-func GetPrecision(numStr string) int {
-	dotIndex := strings.Index(numStr, ".")
-	oneIndex := strings.Index(numStr, "1")
+// splitSymbols distributes the symbols round-robin over the requested number of
+// connections, opening more of them when a connection would exceed the limit.
+func splitSymbols(symbols []MarketSymbol, connections, limit int) [][]MarketSymbol {
+	if connections < 1 {
+		connections = 1
+	}
+	if need := (len(symbols) + limit - 1) / limit; need > connections {
+		connections = need
+	}
+	if connections > len(symbols) {
+		connections = len(symbols)
+	}
 
-	if dotIndex == -1 {
-		return 0
+	groups := make([][]MarketSymbol, connections)
+	for idx, symbol := range symbols {
+		groups[idx%connections] = append(groups[idx%connections], symbol)
 	}
 
-	if oneIndex == 0 {
+	return groups
+}
+
+// closeStreams closes every connection of the map once.
+func closeStreams(streams map[string]*websocket.WebSocketApp) {
+	closed := make(map[*websocket.WebSocketApp]bool)
+	for _, ws := range streams {
+		if !closed[ws] {
+			closed[ws] = true
+			ws.Close()
+		}
+	}
+}
+
+// FillQuote walks the levels until the quote amount is spent (or received)
+// and returns the filled base and quote quantities. It reports false when the
+// levels are not deep enough for the whole amount.
+func FillQuote(levels []PriceLevel, amount float64) (float64, float64, bool) {
+	base, quote := 0.0, 0.0
+	for _, level := range levels {
+		price, quantity := level.Price.Float64(), level.Quantity.Float64()
+		notional := price * quantity
+		if quote+notional >= amount {
+			base += (amount - quote) / price
+			return base, amount, true
+		}
+		base += quantity
+		quote += notional
+	}
+	return base, quote, false
+}
+
+// FillBase walks the levels until the base amount is filled and returns the
+// filled base and quote quantities.
+func FillBase(levels []PriceLevel, amount float64) (float64, float64, bool) {
+	base, quote := 0.0, 0.0
+	for _, level := range levels {
+		price, quantity := level.Price.Float64(), level.Quantity.Float64()
+		if base+quantity >= amount {
+			quote += (amount - base) * price
+			return amount, quote, true
+		}
+		base += quantity
+		quote += price * quantity
+	}
+	return base, quote, false
+}
+
+// GetPrecision is the number of decimal places of a step or tick size, e.g.
+// 8 for "0.00000001", 1 for "0.5" and 0 for "10".
+func GetPrecision(numStr string) int {
+	step, err := decimal.Parse(numStr)
+	if err != nil {
 		return 0
 	}
+	return step.Scale()
+}
+
+// Instrument describes a spot pair currently trading on the exchange.
+type Instrument struct {
+	BaseAsset   string
+	QuoteAsset  string
+	Margin      bool
+	LastPrice   float64
+	QuoteVolume float64
+}
+
+// Balance is the margin account position of an asset.
+type Balance struct {
+	Asset    string
+	Free     float64
+	Locked   float64
+	Borrowed float64
+	Interest float64
+}
+
+// Net is the amount owned once the debt and its interest are repaid.
+func (b Balance) Net() float64 {
+	return b.Free + b.Locked - b.Borrowed - b.Interest
+}
+
+// ErrOrderNotFound is returned by GetOrder when the exchange has no order with
+// the client id, i.e. it has never been placed.
+var ErrOrderNotFound = errors.New("order not found")
+
+// OrderResult is the outcome of an order as reported by the exchange. Fees
+// hold the commission charged per asset.
+type OrderResult struct {
+	OrderID       string
+	ClientOrderID string
+	Symbol        string
+	Side          string
+	Status        string
+	ExecutedQty   float64
+	QuoteQty      float64
+	AvgPrice      float64
+	Fees          map[string]float64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Received is the net amount of the asset the order acquired: the base asset
+// for BUY and the quote asset for SELL, less the fee charged in that asset.
+func (r *OrderResult) Received(symbol MarketSymbol) float64 {
+	if r.Side == "BUY" {
+		return r.ExecutedQty - r.Fees[symbol.GetBaseAsset()]
+	}
+	return r.QuoteQty - r.Fees[symbol.GetQuoteAsset()]
+}
 
-	precision := len(numStr[dotIndex:oneIndex])
+// Spent is the amount of the asset the order gave away, including the fee
+// charged in that asset.
+func (r *OrderResult) Spent(symbol MarketSymbol) float64 {
+	if r.Side == "BUY" {
+		return r.QuoteQty + r.Fees[symbol.GetQuoteAsset()]
+	}
+	return r.ExecutedQty + r.Fees[symbol.GetBaseAsset()]
+}
 
-	return precision
+// FeeRate is the share of the acquired asset withheld as fee.
+func (r *OrderResult) FeeRate(symbol MarketSymbol) float64 {
+	gross, asset := r.QuoteQty, symbol.GetQuoteAsset()
+	if r.Side == "BUY" {
+		gross, asset = r.ExecutedQty, symbol.GetBaseAsset()
+	}
+	if gross == 0 {
+		return 0.0
+	}
+	return r.Fees[asset] / gross
 }
 
 type SymbolPrecision struct {
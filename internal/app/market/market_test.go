@@ -0,0 +1,73 @@
+package market
+
+import (
+	"tarbitrage/pkg/decimal"
+	"testing"
+)
+
+func TestGetPrecision(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"10", 0},
+		{"0.5", 1},
+		{"0.01000000", 2},
+		{"0.00000001", 8},
+		{"1e-8", 8},
+		{"1", 0},
+		{"", 0},
+		{"abc", 0},
+	}
+
+	for _, tt := range tests {
+		if got := GetPrecision(tt.in); got != tt.want {
+			t.Errorf("GetPrecision(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSymbolFiltersCheck(t *testing.T) {
+	filters := SymbolFilters{
+		MinQty:      decimal.MustParse("0.001"),
+		MaxQty:      decimal.MustParse("1000"),
+		MinNotional: decimal.MustParse("10"),
+	}
+
+	tests := []struct {
+		quantity decimal.Decimal
+		notional decimal.Decimal
+		ok       bool
+	}{
+		{decimal.MustParse("1"), decimal.MustParse("100"), true},
+		{decimal.MustParse("0.0001"), decimal.MustParse("100"), false},
+		{decimal.MustParse("1001"), decimal.MustParse("100"), false},
+		{decimal.MustParse("1"), decimal.MustParse("5"), false},
+		{decimal.Max, decimal.MustParse("100"), false},
+		{decimal.MustParse("1"), decimal.FromFloat(1e30), false},
+	}
+
+	for _, tt := range tests {
+		if err := filters.Check(tt.quantity, tt.notional); (err == nil) != tt.ok {
+			t.Errorf("Check(%s, %s) = %v, want ok %v", tt.quantity, tt.notional, err, tt.ok)
+		}
+	}
+}
+
+func TestNewPrivateClientPublicOnly(t *testing.T) {
+	endpoints, err := GetEndpoints("BINANCE", "testnet", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPrivateClient("BINANCE", endpoints, "key", "secret", ""); err == nil {
+		t.Error("a private client was created on the Binance Spot Testnet")
+	}
+
+	endpoints, err = GetEndpoints("BYBIT", "testnet", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPrivateClient("BYBIT", endpoints, "key", "secret", ""); err != nil {
+		t.Errorf("Bybit Testnet: %v", err)
+	}
+}
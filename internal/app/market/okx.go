@@ -0,0 +1,895 @@
+package market
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"tarbitrage/pkg/decimal"
+	"tarbitrage/pkg/websocket"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type OKXPublicClient struct {
+	name      string
+	Endpoints Endpoints
+	Logger    *logrus.Logger
+	Heartbeat time.Duration
+}
+
+type OKXPrivateClient struct {
+	name       string
+	Endpoints  Endpoints
+	Key        string
+	Secret     string
+	Passphrase string
+	Logger     *logrus.Logger
+	Clock      Clock
+	RecvWindow time.Duration
+}
+
+var OKXHeaders = map[string]string{
+	"Content-Type": "application/json",
+}
+
+var OKXSides = map[string]string{
+	"BUY":  "buy",
+	"SELL": "sell",
+}
+
+type OKXSymbol struct {
+	BaseAsset      string
+	QuoteAsset     string
+	Symbol         string
+	BaseSymbol     string
+	BasePrecision  int
+	PricePrecision int
+	Filters        SymbolFilters
+}
+
+func (s *OKXSymbol) GetBaseAsset() string {
+	return s.BaseAsset
+}
+
+func (s *OKXSymbol) GetQuoteAsset() string {
+	return s.QuoteAsset
+}
+
+func (s *OKXSymbol) GetBaseSymbol() string {
+	return s.BaseSymbol
+}
+
+func (s *OKXSymbol) GetSymbol() string {
+	return s.Symbol
+}
+
+func (s *OKXSymbol) GetBasePrecision() int {
+	return s.BasePrecision
+}
+
+func (s *OKXSymbol) GetPricePrecision() int {
+	return s.PricePrecision
+}
+
+func (s *OKXSymbol) SetBasePrecision(prec int) {
+	s.BasePrecision = prec
+}
+
+func (s *OKXSymbol) SetPricePrecision(prec int) {
+	s.PricePrecision = prec
+}
+
+func (s *OKXSymbol) GetFilters() SymbolFilters {
+	return s.Filters
+}
+
+func (s *OKXSymbol) SetFilters(filters SymbolFilters) {
+	s.Filters = filters
+}
+
+func (c *OKXPublicClient) Name() string {
+	return c.name
+}
+
+// SetHeartbeat sets the interval of application-level pings, zero disables them.
+func (c *OKXPublicClient) SetHeartbeat(interval time.Duration) {
+	c.Heartbeat = interval
+}
+
+func (c *OKXPrivateClient) Name() string {
+	return c.name
+}
+
+func (c *OKXPrivateClient) GetKey() string {
+	return c.Key
+}
+
+func (c *OKXPrivateClient) GetSecret() string {
+	return c.Secret
+}
+
+// SupportsShort is true, orders borrow on the cross margin account.
+func (c *OKXPrivateClient) SupportsShort() bool {
+	return true
+}
+
+// CreateSymbol maps "ETH+BTC" to the instrument id "ETH-BTC".
+func (c *OKXPublicClient) CreateSymbol(base_symbol string) MarketSymbol {
+	assets := strings.Split(base_symbol, "+")
+	return &OKXSymbol{
+		BaseAsset:  assets[0],
+		QuoteAsset: assets[1],
+		Symbol:     assets[0] + "-" + assets[1],
+		BaseSymbol: base_symbol,
+	}
+}
+
+// OKXMaxTopics is the number of channels subscribed over a single connection
+// and OKXMaxArgs the number of channels a single subscribe request may carry.
+var OKXMaxTopics = 200
+var OKXMaxArgs = 50
+
+// RunOrderBookStreams subscribes the symbols over the given number of
+// connections. 1 level selects the bbo-tbt channel, any other number the
+// books5 channel; both push the whole book every time.
+func (c *OKXPublicClient) RunOrderBookStreams(symbols []MarketSymbol, levels string, connections int,
+	handler OrderBookHandler, errHandler websocket.ErrHandler) (map[string]*websocket.WebSocketApp, error) {
+
+	channel := "books5"
+	if levels == "1" {
+		channel = "bbo-tbt"
+	}
+
+	streams := make(map[string]*websocket.WebSocketApp)
+
+	for idx, group := range splitSymbols(symbols, connections, OKXMaxTopics) {
+		books := make([]*okxBook, len(group))
+		for i, symbol := range group {
+			books[i] = &okxBook{
+				symbol:  symbol,
+				channel: channel,
+				local:   NewLocalOrderBook(),
+				handler: handler,
+			}
+		}
+
+		wsApp, err := c.runDepthConnection(idx, books, errHandler)
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		for _, symbol := range group {
+			streams[symbol.GetBaseSymbol()] = wsApp
+		}
+	}
+
+	return streams, nil
+}
+
+type okxArg struct {
+	Channel string `json:"channel"`
+	InstID  string `json:"instId"`
+}
+
+type okxBookData struct {
+	Asks [][]string `json:"asks"`
+	Bids [][]string `json:"bids"`
+	Time string     `json:"ts"`
+	Seq  int64      `json:"seqId"`
+}
+
+type okxEvent struct {
+	Event   string        `json:"event"`
+	Code    string        `json:"code"`
+	Message string        `json:"msg"`
+	Arg     okxArg        `json:"arg"`
+	Data    []okxBookData `json:"data"`
+}
+
+func okxSubscribe(ws *websocket.WebSocketApp, op string, args []okxArg) {
+	for i := 0; i < len(args); i += OKXMaxArgs {
+		j := i + OKXMaxArgs
+		if j > len(args) {
+			j = len(args)
+		}
+		subscription := map[string]interface{}{
+			"op":   op,
+			"args": args[i:j],
+		}
+		ws.Send(subscription)
+	}
+}
+
+func (c *OKXPublicClient) runDepthConnection(id int, books []*okxBook,
+	errHandler websocket.ErrHandler) (*websocket.WebSocketApp, error) {
+
+	endpoint := c.Endpoints.Ws
+	wsApp := new(websocket.WebSocketApp)
+
+	byInstrument := make(map[string]*okxBook, len(books))
+	args := make([]okxArg, len(books))
+	for idx, book := range books {
+		byInstrument[book.symbol.GetSymbol()] = book
+		args[idx] = okxArg{Channel: book.channel, InstID: book.symbol.GetSymbol()}
+	}
+
+	wsApp.OnOpen = func(ws *websocket.WebSocketApp) {
+		for _, book := range books {
+			book.local.Reset()
+			book.handler(StaleEvent(book.symbol.GetBaseSymbol()))
+		}
+		okxSubscribe(ws, "subscribe", args)
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d (%d symbols) has been started.\n", c.Name(), id, len(books)))
+	}
+	wsApp.OnMessage = func(ws *websocket.WebSocketApp, message []byte) {
+		// the reply to a text ping is not json
+		if string(message) == "pong" {
+			return
+		}
+
+		e := new(okxEvent)
+		err := json.Unmarshal(message, e)
+
+		if err != nil {
+			errHandler(err)
+			return
+		}
+
+		if e.Event == "error" {
+			errHandler(fmt.Errorf("okx error: code: %s, message: %s", e.Code, e.Message))
+			return
+		}
+
+		book, ok := byInstrument[e.Arg.InstID]
+		if !ok || len(e.Data) == 0 {
+			return
+		}
+
+		book.process(&e.Data[0])
+	}
+	wsApp.OnError = func(ws *websocket.WebSocketApp, err error) {
+		c.Logger.Log(logrus.InfoLevel, err)
+	}
+	wsApp.OnClose = func(ws *websocket.WebSocketApp) {
+		c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is stopped.\n", c.Name(), id))
+	}
+	wsApp.OnStateChange = func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+		if state == websocket.StateReconnecting {
+			c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Stream %s #%d is reconnecting.\n", c.Name(), id))
+		}
+	}
+	wsApp.Heartbeat = c.Heartbeat
+	wsApp.OnHeartbeat = func(ws *websocket.WebSocketApp) {
+		if err := ws.SendText([]byte("ping")); err != nil {
+			c.Logger.Log(logrus.InfoLevel, err)
+		}
+	}
+
+	if err := wsApp.Run(endpoint, false, 0); err != nil {
+		return nil, err
+	}
+
+	return wsApp, nil
+}
+
+type okxBook struct {
+	symbol  MarketSymbol
+	channel string
+	local   *LocalOrderBook
+	handler OrderBookHandler
+}
+
+// process replaces the book, every push of books5 and bbo-tbt is a snapshot.
+func (b *okxBook) process(data *okxBookData) {
+	if len(data.Asks) == 0 {
+		return
+	}
+
+	ts, _ := strconv.ParseInt(data.Time, 10, 64)
+
+	b.local.ApplySnapshot(data.Asks, data.Bids)
+	b.local.Sequence = data.Seq
+	b.local.EventTime = time.UnixMilli(ts)
+
+	b.handler(b.local.Event(b.symbol.GetBaseSymbol(), 0))
+}
+
+func (c *OKXPublicClient) GetInstrumentsInfo(symbols []MarketSymbol) error {
+	parameters := map[string]interface{}{
+		"instType": "SPOT",
+	}
+
+	type SymbolData struct {
+		InstID   string `json:"instId"`
+		TickSize string `json:"tickSz"`
+		LotSize  string `json:"lotSz"`
+		MinSize  string `json:"minSz"`
+		MaxSize  string `json:"maxMktSz"`
+	}
+
+	type response struct {
+		Code    string       `json:"code"`
+		Message string       `json:"msg"`
+		Data    []SymbolData `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(parameters, "/api/v5/public/instruments", "GET", resp); err != nil {
+		return err
+	}
+
+	if resp.Code != "0" {
+		return fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	byInstrument := make(map[string]SymbolData, len(resp.Data))
+	for _, data := range resp.Data {
+		byInstrument[data.InstID] = data
+	}
+
+	for _, s := range symbols {
+		data, ok := byInstrument[s.GetSymbol()]
+		if !ok {
+			return fmt.Errorf("can't find precision information for symbol %s", s.GetBaseSymbol())
+		}
+		s.SetBasePrecision(GetPrecision(data.LotSize))
+		s.SetPricePrecision(GetPrecision(data.TickSize))
+
+		filters := SymbolFilters{}
+		filters.StepSize, _ = decimal.Parse(data.LotSize)
+		filters.MinQty, _ = decimal.Parse(data.MinSize)
+		filters.MaxQty, _ = decimal.Parse(data.MaxSize)
+		filters.TickSize, _ = decimal.Parse(data.TickSize)
+		s.SetFilters(filters)
+	}
+
+	return nil
+}
+
+// GetSpotInstruments lists the live spot pairs; the margin flag comes from the
+// MARGIN instrument list.
+func (c *OKXPublicClient) GetSpotInstruments() ([]Instrument, error) {
+	type SymbolData struct {
+		InstID     string `json:"instId"`
+		BaseAsset  string `json:"baseCcy"`
+		QuoteAsset string `json:"quoteCcy"`
+		State      string `json:"state"`
+	}
+
+	type response struct {
+		Code    string       `json:"code"`
+		Message string       `json:"msg"`
+		Data    []SymbolData `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.Perform(map[string]interface{}{"instType": "SPOT"}, "/api/v5/public/instruments", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	margin := new(response)
+
+	if err := c.Perform(map[string]interface{}{"instType": "MARGIN"}, "/api/v5/public/instruments", "GET", margin); err != nil {
+		return nil, err
+	}
+
+	if margin.Code != "0" {
+		return nil, fmt.Errorf("okx error: code: %s, message: %s", margin.Code, margin.Message)
+	}
+
+	marginable := make(map[string]bool, len(margin.Data))
+	for _, data := range margin.Data {
+		marginable[data.InstID] = data.State == "live"
+	}
+
+	type ticker struct {
+		InstID    string `json:"instId"`
+		LastPrice string `json:"last"`
+		Turnover  string `json:"volCcy24h"`
+	}
+
+	type tickersResponse struct {
+		Code    string   `json:"code"`
+		Message string   `json:"msg"`
+		Data    []ticker `json:"data"`
+	}
+
+	tickers := new(tickersResponse)
+
+	if err := c.Perform(map[string]interface{}{"instType": "SPOT"}, "/api/v5/market/tickers", "GET", tickers); err != nil {
+		return nil, err
+	}
+
+	if tickers.Code != "0" {
+		return nil, fmt.Errorf("okx error: code: %s, message: %s", tickers.Code, tickers.Message)
+	}
+
+	stats := make(map[string]ticker, len(tickers.Data))
+	for _, t := range tickers.Data {
+		stats[t.InstID] = t
+	}
+
+	instruments := make([]Instrument, 0, len(resp.Data))
+	for _, data := range resp.Data {
+		if data.State != "live" {
+			continue
+		}
+		price, _ := strconv.ParseFloat(stats[data.InstID].LastPrice, 64)
+		volume, _ := strconv.ParseFloat(stats[data.InstID].Turnover, 64)
+		instruments = append(instruments, Instrument{
+			BaseAsset:   data.BaseAsset,
+			QuoteAsset:  data.QuoteAsset,
+			Margin:      marginable[data.InstID],
+			LastPrice:   price,
+			QuoteVolume: volume,
+		})
+	}
+
+	return instruments, nil
+}
+
+// okxQuery joins the parameters sorted by key.
+func okxQuery(query map[string]interface{}) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var queryStrings []string
+	for _, k := range keys {
+		if v := query[k]; v != nil {
+			queryStrings = append(queryStrings, fmt.Sprintf("%s=%v", k, v))
+		}
+	}
+	return strings.Join(queryStrings, "&")
+}
+
+func (c *OKXPublicClient) Perform(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	url := fmt.Sprintf("%s%s", c.Endpoints.Rest, method)
+	if queryString := okxQuery(query); queryString != "" {
+		url += "?" + queryString
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, url, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range OKXHeaders {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// generateSignature signs timestamp + method + request path (with the query)
+// + body with the secret and encodes the digest in base64.
+func (c *OKXPrivateClient) generateSignature(timestamp, session_method, path, body string) string {
+	h := hmac.New(sha256.New, []byte(c.Secret))
+	h.Write([]byte(timestamp + session_method + path + body))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (c *OKXPrivateClient) PerformSign(query map[string]interface{}, method string, session_method string, result interface{}) error {
+	path := method
+	body := ""
+
+	if session_method == "GET" {
+		if queryString := okxQuery(query); queryString != "" {
+			path += "?" + queryString
+		}
+	} else {
+		payload, err := json.Marshal(query)
+		if err != nil {
+			return err
+		}
+		body = string(payload)
+	}
+
+	now := c.Clock.Now()
+	timestamp := time.UnixMilli(now).UTC().Format("2006-01-02T15:04:05.000Z")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest(session_method, c.Endpoints.Rest+path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for key, value := range OKXHeaders {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("OK-ACCESS-KEY", c.Key)
+	req.Header.Set("OK-ACCESS-SIGN", c.generateSignature(timestamp, session_method, path, body))
+	req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+	req.Header.Set("OK-ACCESS-PASSPHRASE", c.Passphrase)
+	if c.RecvWindow > 0 {
+		req.Header.Set("expTime", strconv.FormatInt(now+c.RecvWindow.Milliseconds(), 10))
+	}
+
+	if body != "" {
+		req.Body = io.NopCloser(bytes.NewReader([]byte(body)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SyncTime measures the offset of the local clock from /api/v5/public/time.
+func (c *OKXPrivateClient) SyncTime() (time.Duration, error) {
+	return c.Clock.Sync(func() (int64, error) {
+		type server struct {
+			Time string `json:"ts"`
+		}
+
+		type result struct {
+			Code    string   `json:"code"`
+			Message string   `json:"msg"`
+			Data    []server `json:"data"`
+		}
+
+		resp := new(result)
+		if err := (&OKXPublicClient{Endpoints: c.Endpoints}).Perform(map[string]interface{}{}, "/api/v5/public/time", "GET", resp); err != nil {
+			return 0, err
+		}
+		if resp.Code != "0" || len(resp.Data) == 0 {
+			return 0, fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+		}
+		return strconv.ParseInt(resp.Data[0].Time, 10, 64)
+	})
+}
+
+// SetRecvWindow sets how long a request stays valid, sent as its expTime.
+func (c *OKXPrivateClient) SetRecvWindow(window time.Duration) {
+	c.RecvWindow = window
+}
+
+func (c *OKXPrivateClient) ApplyInitial(lot float64) error {
+	balance, err := c.GetMarginBalance()
+	if err != nil {
+		return err
+	}
+	if balance < lot {
+		return fmt.Errorf("you have not enough balance (should be greater than lot)")
+	}
+	return nil
+}
+
+type okxBalanceDetail struct {
+	Currency  string `json:"ccy"`
+	Available string `json:"availBal"`
+	Frozen    string `json:"frozenBal"`
+	Liability string `json:"liab"`
+	Interest  string `json:"interest"`
+}
+
+type okxBalance struct {
+	TotalEquity    string             `json:"totalEq"`
+	AdjustedEquity string             `json:"adjEq"`
+	Details        []okxBalanceDetail `json:"details"`
+}
+
+func (c *OKXPrivateClient) getBalance() (*okxBalance, error) {
+	type result struct {
+		Code    string       `json:"code"`
+		Message string       `json:"msg"`
+		Data    []okxBalance `json:"data"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(map[string]interface{}{}, "/api/v5/account/balance", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("okx error: empty account balance")
+	}
+
+	return &resp.Data[0], nil
+}
+
+// GetMarginBalance is the adjusted equity of the account in USD, or the total
+// equity when the account is not in a margin mode.
+func (c *OKXPrivateClient) GetMarginBalance() (float64, error) {
+	balance, err := c.getBalance()
+	if err != nil {
+		return 0.0, err
+	}
+
+	equity := balance.AdjustedEquity
+	if equity == "" {
+		equity = balance.TotalEquity
+	}
+	available, _ := strconv.ParseFloat(equity, 64)
+
+	return available, nil
+}
+
+// GetBalances returns the trading account position of every currency; the
+// liability includes the accrued interest.
+func (c *OKXPrivateClient) GetBalances() (map[string]Balance, error) {
+	balance, err := c.getBalance()
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]Balance)
+	for _, d := range balance.Details {
+		b := Balance{Asset: d.Currency}
+		b.Free, _ = strconv.ParseFloat(d.Available, 64)
+		b.Locked, _ = strconv.ParseFloat(d.Frozen, 64)
+		liability, _ := strconv.ParseFloat(d.Liability, 64)
+		interest, _ := strconv.ParseFloat(d.Interest, 64)
+		b.Interest = math.Abs(interest)
+		b.Borrowed = math.Max(math.Abs(liability)-b.Interest, 0)
+		balances[d.Currency] = b
+	}
+
+	return balances, nil
+}
+
+func (c *OKXPrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	parameters := map[string]interface{}{
+		"ccy":  asset,
+		"side": "repay",
+		"amt":  amount.String(),
+	}
+
+	type result struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/api/v5/account/spot-manual-borrow-repay", "POST", resp); err != nil {
+		return err
+	}
+	if resp.Code != "0" {
+		return fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	return nil
+}
+
+// GetFees returns the taker fee in percent per base symbol. OKX charges one
+// rate per fee tier, with a separate one for USDC pairs; rates are negative
+// when charged.
+func (c *OKXPrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	parameters := map[string]interface{}{
+		"instType": "SPOT",
+	}
+
+	type fee struct {
+		Taker     string `json:"taker"`
+		TakerUSDC string `json:"takerUSDC"`
+	}
+
+	type result struct {
+		Code    string `json:"code"`
+		Message string `json:"msg"`
+		Data    []fee  `json:"data"`
+	}
+
+	resp := new(result)
+	if err := c.PerformSign(parameters, "/api/v5/account/trade-fee", "GET", resp); err != nil {
+		return nil, err
+	}
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("okx error: code: %s, message: %s", resp.Code, resp.Message)
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("okx error: empty fee rates")
+	}
+
+	taker, err := strconv.ParseFloat(resp.Data[0].Taker, 64)
+	if err != nil {
+		return nil, err
+	}
+	usdc, err := strconv.ParseFloat(resp.Data[0].TakerUSDC, 64)
+	if err != nil {
+		usdc = taker
+	}
+
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		rate := taker
+		if s.GetQuoteAsset() == "USDC" {
+			rate = usdc
+		}
+		fees[s.GetBaseSymbol()] = -rate * 100
+	}
+
+	return fees, nil
+}
+
+// okxClientID drops the characters OKX does not accept in a client order id,
+// which may only be alphanumeric.
+func okxClientID(clientID string) string {
+	return strings.ReplaceAll(clientID, "-", "")
+}
+
+// PlaceOrder places a cross margin market order, borrowing what the account
+// lacks. The size of "open" orders is in the quote asset.
+func (c *OKXPrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+
+	parameters := map[string]interface{}{
+		"instId":  symbol.GetSymbol(),
+		"tdMode":  "cross",
+		"side":    OKXSides[side],
+		"ordType": "market",
+		"sz":      quantity.String(),
+		"clOrdId": okxClientID(clientID),
+	}
+
+	switch t {
+	case "open":
+		parameters["tgtCcy"] = "quote_ccy"
+	case "close":
+		parameters["tgtCcy"] = "base_ccy"
+	}
+
+	type result struct {
+		OrderID string `json:"ordId"`
+		Code    string `json:"sCode"`
+		Message string `json:"sMsg"`
+	}
+
+	type response struct {
+		Code    string   `json:"code"`
+		Message string   `json:"msg"`
+		Data    []result `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.PerformSign(parameters, "/api/v5/trade/order", "POST", resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Data) > 0 && resp.Data[0].Code != "0" {
+		return nil, fmt.Errorf("okx error while creating order: code: %s, message: %s", resp.Data[0].Code, resp.Data[0].Message)
+	}
+	if resp.Code != "0" || len(resp.Data) == 0 {
+		return nil, fmt.Errorf("okx error while creating order: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	orderData, err := c.queryOrder(map[string]interface{}{
+		"instId": symbol.GetSymbol(),
+		"ordId":  resp.Data[0].OrderID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orderData.result(clientID), nil
+}
+
+// GetOrder looks the order up by client id.
+func (c *OKXPrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	orderData, err := c.queryOrder(map[string]interface{}{
+		"instId":  symbol.GetSymbol(),
+		"clOrdId": okxClientID(clientID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orderData.result(clientID), nil
+}
+
+func (c *OKXPrivateClient) queryOrder(parameters map[string]interface{}) (*OKXOrderData, error) {
+	type response struct {
+		Code    string         `json:"code"`
+		Message string         `json:"msg"`
+		Data    []OKXOrderData `json:"data"`
+	}
+
+	resp := new(response)
+
+	if err := c.PerformSign(parameters, "/api/v5/trade/order", "GET", resp); err != nil {
+		return nil, err
+	}
+
+	// 51603: order does not exist
+	if resp.Code == "51603" || (resp.Code == "0" && len(resp.Data) == 0) {
+		return nil, ErrOrderNotFound
+	}
+	if resp.Code != "0" {
+		return nil, fmt.Errorf("okx error while fetching order data: code: %s, message: %s", resp.Code, resp.Message)
+	}
+
+	return &resp.Data[0], nil
+}
+
+type OKXOrderData struct {
+	OrderID     string `json:"ordId"`
+	Symbol      string `json:"instId"`
+	State       string `json:"state"`
+	Price       string `json:"avgPx"`
+	Quantity    string `json:"accFillSz"`
+	Side        string `json:"side"`
+	Fee         string `json:"fee"`
+	FeeCurrency string `json:"feeCcy"`
+	CreatedTime string `json:"cTime"`
+	UpdatedTime string `json:"uTime"`
+}
+
+// result converts the order data; the fee is negative when charged and the
+// client id is reported as it was requested.
+func (d *OKXOrderData) result(clientID string) *OrderResult {
+	qty, _ := strconv.ParseFloat(d.Quantity, 64)
+	price, _ := strconv.ParseFloat(d.Price, 64)
+	fee, _ := strconv.ParseFloat(d.Fee, 64)
+	created, _ := strconv.ParseInt(d.CreatedTime, 10, 64)
+	updated, _ := strconv.ParseInt(d.UpdatedTime, 10, 64)
+
+	fees := make(map[string]float64)
+	if d.FeeCurrency != "" {
+		fees[d.FeeCurrency] = -fee
+	}
+
+	return &OrderResult{
+		OrderID:       d.OrderID,
+		ClientOrderID: clientID,
+		Symbol:        d.Symbol,
+		Side:          strings.ToUpper(d.Side),
+		Status:        d.State,
+		ExecutedQty:   qty,
+		QuoteQty:      qty * price,
+		AvgPrice:      price,
+		Fees:          fees,
+		CreatedAt:     time.UnixMilli(created),
+		UpdatedAt:     time.UnixMilli(updated),
+	}
+}
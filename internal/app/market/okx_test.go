@@ -0,0 +1,482 @@
+package market
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"tarbitrage/pkg/decimal"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// okxMock serves the REST routes by "METHOD path" and verifies the signature
+// headers of every private request.
+type okxMock struct {
+	t        *testing.T
+	secret   string
+	routes   map[string]func(w http.ResponseWriter, r *http.Request, body string)
+	requests []*http.Request
+	bodies   []string
+	lock     sync.Mutex
+}
+
+func newOKXMock(t *testing.T) (*okxMock, *httptest.Server, *OKXPrivateClient) {
+	m := &okxMock{
+		t:      t,
+		secret: "secret",
+		routes: make(map[string]func(w http.ResponseWriter, r *http.Request, body string)),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(srv.Close)
+
+	client := &OKXPrivateClient{
+		name:       "OKX",
+		Endpoints:  Endpoints{Rest: srv.URL},
+		Key:        "key",
+		Secret:     m.secret,
+		Passphrase: "passphrase",
+		RecvWindow: DefaultRecvWindow,
+	}
+	return m, srv, client
+}
+
+func (m *okxMock) serve(w http.ResponseWriter, r *http.Request) {
+	payload, _ := io.ReadAll(r.Body)
+	body := string(payload)
+
+	m.lock.Lock()
+	m.requests = append(m.requests, r)
+	m.bodies = append(m.bodies, body)
+	m.lock.Unlock()
+
+	if key := r.Header.Get("OK-ACCESS-KEY"); key != "" {
+		path := r.URL.Path
+		if r.URL.RawQuery != "" {
+			path += "?" + r.URL.RawQuery
+		}
+		h := hmac.New(sha256.New, []byte(m.secret))
+		h.Write([]byte(r.Header.Get("OK-ACCESS-TIMESTAMP") + r.Method + path + body))
+		want := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		if got := r.Header.Get("OK-ACCESS-SIGN"); got != want {
+			m.t.Errorf("%s %s: OK-ACCESS-SIGN = %q, want %q", r.Method, path, got, want)
+		}
+		if got := r.Header.Get("OK-ACCESS-PASSPHRASE"); got != "passphrase" {
+			m.t.Errorf("%s %s: OK-ACCESS-PASSPHRASE = %q, want %q", r.Method, path, got, "passphrase")
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05.000Z", r.Header.Get("OK-ACCESS-TIMESTAMP")); err != nil {
+			m.t.Errorf("%s %s: OK-ACCESS-TIMESTAMP: %v", r.Method, path, err)
+		}
+	}
+
+	route, ok := m.routes[r.Method+" "+r.URL.Path]
+	if !ok {
+		m.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	route(w, r, body)
+}
+
+func (m *okxMock) reply(method, path, response string) {
+	m.routes[method+" "+path] = func(w http.ResponseWriter, r *http.Request, body string) {
+		w.Write([]byte(response))
+	}
+}
+
+func TestOKXSignature(t *testing.T) {
+	m, _, client := newOKXMock(t)
+	m.reply("GET", "/api/v5/account/trade-fee", `{"code":"0","data":[{"taker":"-0.001","takerUSDC":"-0.0008"}]}`)
+	m.reply("POST", "/api/v5/account/spot-manual-borrow-repay", `{"code":"0","data":[]}`)
+
+	symbols := []MarketSymbol{
+		new(OKXPublicClient).CreateSymbol("ETH+USDT"),
+		new(OKXPublicClient).CreateSymbol("ETH+USDC"),
+	}
+	fees, err := client.GetFees(symbols)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fees["ETH+USDT"] != 0.1 || fees["ETH+USDC"] != 0.08 {
+		t.Errorf("fees = %v", fees)
+	}
+
+	if err := client.Repay("USDT", decimal.MustParse("12.5")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(m.requests))
+	}
+	if got := m.requests[0].URL.RawQuery; got != "instType=SPOT" {
+		t.Errorf("trade-fee query = %q", got)
+	}
+	repay := make(map[string]string)
+	if err := json.Unmarshal([]byte(m.bodies[1]), &repay); err != nil {
+		t.Fatal(err)
+	}
+	if repay["ccy"] != "USDT" || repay["side"] != "repay" || repay["amt"] != "12.5" {
+		t.Errorf("repay body = %s", m.bodies[1])
+	}
+}
+
+func TestOKXGetInstrumentsInfo(t *testing.T) {
+	m, srv, _ := newOKXMock(t)
+	m.reply("GET", "/api/v5/public/instruments", `{"code":"0","data":[
+		{"instId":"ETH-BTC","tickSz":"0.00001","lotSz":"0.000001","minSz":"0.001","maxMktSz":"1000"},
+		{"instId":"BTC-USDT","tickSz":"0.1","lotSz":"0.00000001","minSz":"0.00001","maxMktSz":"100"}]}`)
+
+	public := &OKXPublicClient{name: "OKX", Endpoints: Endpoints{Rest: srv.URL}}
+
+	tests := []struct {
+		base_symbol    string
+		basePrecision  int
+		pricePrecision int
+		filters        SymbolFilters
+	}{
+		{"ETH+BTC", 6, 5, SymbolFilters{
+			MinQty:   decimal.MustParse("0.001"),
+			MaxQty:   decimal.MustParse("1000"),
+			StepSize: decimal.MustParse("0.000001"),
+			TickSize: decimal.MustParse("0.00001"),
+		}},
+		{"BTC+USDT", 8, 1, SymbolFilters{
+			MinQty:   decimal.MustParse("0.00001"),
+			MaxQty:   decimal.MustParse("100"),
+			StepSize: decimal.MustParse("0.00000001"),
+			TickSize: decimal.MustParse("0.1"),
+		}},
+	}
+
+	symbols := make([]MarketSymbol, len(tests))
+	for i, tt := range tests {
+		symbols[i] = public.CreateSymbol(tt.base_symbol)
+	}
+	if err := public.GetInstrumentsInfo(symbols); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, tt := range tests {
+		s := symbols[i]
+		if s.GetSymbol() != strings.Replace(tt.base_symbol, "+", "-", 1) {
+			t.Errorf("%s: symbol = %s", tt.base_symbol, s.GetSymbol())
+		}
+		if s.GetBasePrecision() != tt.basePrecision || s.GetPricePrecision() != tt.pricePrecision {
+			t.Errorf("%s: precision = %d/%d, want %d/%d", tt.base_symbol,
+				s.GetBasePrecision(), s.GetPricePrecision(), tt.basePrecision, tt.pricePrecision)
+		}
+		f := s.GetFilters()
+		if !f.MinQty.Equal(tt.filters.MinQty) || !f.MaxQty.Equal(tt.filters.MaxQty) ||
+			!f.StepSize.Equal(tt.filters.StepSize) || !f.TickSize.Equal(tt.filters.TickSize) {
+			t.Errorf("%s: filters = %+v, want %+v", tt.base_symbol, f, tt.filters)
+		}
+	}
+
+	if got := m.requests[0].URL.RawQuery; got != "instType=SPOT" {
+		t.Errorf("instruments query = %q", got)
+	}
+
+	missing := []MarketSymbol{public.CreateSymbol("XRP+BTC")}
+	if err := public.GetInstrumentsInfo(missing); err == nil {
+		t.Error("no error for a symbol missing from the instrument list")
+	}
+}
+
+func TestOKXPlaceOrder(t *testing.T) {
+	tests := []struct {
+		side   string
+		t      string
+		tgtCcy string
+	}{
+		{"BUY", "open", "quote_ccy"},
+		{"SELL", "open", "quote_ccy"},
+		{"BUY", "close", "base_ccy"},
+		{"SELL", "close", "base_ccy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.side+"/"+tt.t, func(t *testing.T) {
+			m, _, client := newOKXMock(t)
+			var order map[string]string
+			m.routes["POST /api/v5/trade/order"] = func(w http.ResponseWriter, r *http.Request, body string) {
+				if err := json.Unmarshal([]byte(body), &order); err != nil {
+					t.Error(err)
+				}
+				w.Write([]byte(`{"code":"0","data":[{"ordId":"42","clOrdId":"ta1x1","sCode":"0","sMsg":""}]}`))
+			}
+			m.routes["GET /api/v5/trade/order"] = func(w http.ResponseWriter, r *http.Request, body string) {
+				if r.URL.Query().Get("ordId") != "42" || r.URL.Query().Get("instId") != "ETH-BTC" {
+					t.Errorf("order query = %q", r.URL.RawQuery)
+				}
+				w.Write([]byte(`{"code":"0","data":[{"ordId":"42","instId":"ETH-BTC","state":"filled","avgPx":"0.05",
+					"accFillSz":"2","side":"` + OKXSides[tt.side] + `","fee":"-0.002","feeCcy":"ETH","cTime":"1700000000000","uTime":"1700000000100"}]}`))
+			}
+
+			symbol := new(OKXPublicClient).CreateSymbol("ETH+BTC")
+			result, err := client.PlaceOrder(symbol, tt.side, tt.t, decimal.MustParse("0.1"), "ta1x-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{
+				"instId":  "ETH-BTC",
+				"tdMode":  "cross",
+				"side":    OKXSides[tt.side],
+				"ordType": "market",
+				"sz":      "0.1",
+				"clOrdId": "ta1x1",
+				"tgtCcy":  tt.tgtCcy,
+			}
+			for k, v := range want {
+				if order[k] != v {
+					t.Errorf("order %s = %q, want %q", k, order[k], v)
+				}
+			}
+
+			if result.OrderID != "42" || result.ClientOrderID != "ta1x-1" || result.Side != tt.side {
+				t.Errorf("result = %+v", result)
+			}
+			if result.ExecutedQty != 2 || result.AvgPrice != 0.05 || result.QuoteQty != 0.1 {
+				t.Errorf("fill = %v @ %v (%v)", result.ExecutedQty, result.AvgPrice, result.QuoteQty)
+			}
+			if result.Fees["ETH"] != 0.002 {
+				t.Errorf("fees = %v", result.Fees)
+			}
+			if !result.UpdatedAt.Equal(time.UnixMilli(1700000000100)) {
+				t.Errorf("updated at %v", result.UpdatedAt)
+			}
+		})
+	}
+}
+
+func TestOKXPlaceOrderRejected(t *testing.T) {
+	m, _, client := newOKXMock(t)
+	m.reply("POST", "/api/v5/trade/order",
+		`{"code":"1","msg":"Operation failed.","data":[{"ordId":"","sCode":"51008","sMsg":"Order failed. Insufficient balance."}]}`)
+
+	symbol := new(OKXPublicClient).CreateSymbol("ETH+BTC")
+	result, err := client.PlaceOrder(symbol, "BUY", "open", decimal.MustParse("0.1"), "ta1x-1")
+	if err == nil {
+		t.Fatalf("no error for a rejected order, result %+v", result)
+	}
+	if !strings.Contains(err.Error(), "51008") || !strings.Contains(err.Error(), "Insufficient balance") {
+		t.Errorf("error %q does not carry sCode and sMsg", err)
+	}
+	if len(m.requests) != 1 {
+		t.Errorf("%d requests after a rejection, want 1", len(m.requests))
+	}
+}
+
+func TestOKXGetOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		err      error
+	}{
+		{"not found", `{"code":"51603","msg":"Order does not exist","data":[]}`, ErrOrderNotFound},
+		{"empty", `{"code":"0","msg":"","data":[]}`, ErrOrderNotFound},
+		{"found", `{"code":"0","data":[{"ordId":"7","instId":"ETH-BTC","state":"filled","avgPx":"0.05","accFillSz":"1","side":"sell"}]}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, client := newOKXMock(t)
+			m.routes["GET /api/v5/trade/order"] = func(w http.ResponseWriter, r *http.Request, body string) {
+				if got := r.URL.Query().Get("clOrdId"); got != "ta1x2" {
+					t.Errorf("clOrdId = %q", got)
+				}
+				w.Write([]byte(tt.response))
+			}
+
+			symbol := new(OKXPublicClient).CreateSymbol("ETH+BTC")
+			result, err := client.GetOrder(symbol, "ta1x-2")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && (result.ClientOrderID != "ta1x-2" || result.Side != "SELL") {
+				t.Errorf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestOKXGetBalances(t *testing.T) {
+	m, _, client := newOKXMock(t)
+	m.reply("GET", "/api/v5/account/balance", `{"code":"0","data":[{"totalEq":"1200","adjEq":"1000.5","details":[
+		{"ccy":"USDT","availBal":"900","frozenBal":"10","liab":"","interest":""},
+		{"ccy":"ETH","availBal":"0","frozenBal":"0","liab":"-1.51","interest":"-0.01"},
+		{"ccy":"BTC","availBal":"0.5","frozenBal":"0","liab":"0.2","interest":"0.002"}]}]}`)
+
+	balances, err := client.GetBalances()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []Balance{
+		{Asset: "USDT", Free: 900, Locked: 10},
+		{Asset: "ETH", Borrowed: 1.5, Interest: 0.01},
+		{Asset: "BTC", Free: 0.5, Borrowed: 0.198, Interest: 0.002},
+	}
+	for _, want := range tests {
+		got := balances[want.Asset]
+		if got.Asset != want.Asset || got.Free != want.Free || got.Locked != want.Locked ||
+			!approx(got.Borrowed, want.Borrowed) || !approx(got.Interest, want.Interest) {
+			t.Errorf("%s: balance = %+v, want %+v", want.Asset, got, want)
+		}
+	}
+
+	margin, err := client.GetMarginBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if margin != 1000.5 {
+		t.Errorf("margin balance = %v, want adjusted equity", margin)
+	}
+}
+
+func approx(a, b float64) bool {
+	d := a - b
+	return d < 1e-12 && d > -1e-12
+}
+
+func TestOKXOrderBookStream(t *testing.T) {
+	upgrader := gorilla.Upgrader{}
+	subscribed := make(chan []okxArg, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		var subscription struct {
+			Op   string   `json:"op"`
+			Args []okxArg `json:"args"`
+		}
+		if err := conn.ReadJSON(&subscription); err != nil {
+			t.Error(err)
+			return
+		}
+		if subscription.Op != "subscribe" {
+			t.Errorf("op = %q", subscription.Op)
+		}
+		subscribed <- subscription.Args
+
+		conn.WriteMessage(gorilla.TextMessage, []byte(`{"event":"subscribe","arg":{"channel":"books5","instId":"ETH-BTC"},"connId":"a"}`))
+		conn.WriteMessage(gorilla.TextMessage, []byte(`{"arg":{"channel":"books5","instId":"ETH-BTC"},"data":[{
+			"asks":[["0.0502","3","0","1"],["0.0501","1","0","1"]],
+			"bids":[["0.0499","2","0","1"],["0.05","4","0","1"]],
+			"ts":"1700000000000","seqId":123}]}`))
+		// an empty push must not reach the handler
+		conn.WriteMessage(gorilla.TextMessage, []byte(`{"arg":{"channel":"books5","instId":"ETH-BTC"},"data":[{"asks":[],"bids":[],"ts":"1700000000001","seqId":124}]}`))
+		conn.WriteMessage(gorilla.TextMessage, []byte(`{"arg":{"channel":"books5","instId":"BTC-USDT"},"data":[{
+			"asks":[["37000.1","0.5","0","1"]],"bids":[["37000","0.7","0","1"]],"ts":"1700000000002","seqId":9}]}`))
+
+		// keep the connection open until the client closes it
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	public := &OKXPublicClient{
+		name:      "OKX",
+		Endpoints: Endpoints{Ws: "ws" + strings.TrimPrefix(srv.URL, "http")},
+		Logger:    logger,
+	}
+
+	events := make(chan *OrderBookEvent, 4)
+	symbols := []MarketSymbol{public.CreateSymbol("ETH+BTC"), public.CreateSymbol("BTC+USDT")}
+	streams, err := public.RunOrderBookStreams(symbols, "5", 1,
+		func(event *OrderBookEvent) { events <- event },
+		func(err error) { t.Error(err) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeStreams(streams)
+
+	select {
+	case args := <-subscribed:
+		if len(args) != 2 || args[0] != (okxArg{Channel: "books5", InstID: "ETH-BTC"}) ||
+			args[1] != (okxArg{Channel: "books5", InstID: "BTC-USDT"}) {
+			t.Errorf("subscription args = %+v", args)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no subscription")
+	}
+
+	receive := func() *OrderBookEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no order book event")
+		}
+		return nil
+	}
+
+	// the books are reset to stale ones on every (re)connection
+	for _, want := range []string{"ETH+BTC", "BTC+USDT"} {
+		if event := receive(); !event.Stale || event.Symbol != want {
+			t.Errorf("event = %+v, want stale %s", event, want)
+		}
+	}
+
+	event := receive()
+	if event.Symbol != "ETH+BTC" {
+		t.Fatalf("symbol = %s", event.Symbol)
+	}
+	if len(event.Asks) != 2 || !event.Asks[0].Price.Equal(decimal.MustParse("0.0501")) ||
+		!event.Asks[1].Quantity.Equal(decimal.MustParse("3")) {
+		t.Errorf("asks = %+v, want ascending", event.Asks)
+	}
+	if len(event.Bids) != 2 || !event.Bids[0].Price.Equal(decimal.MustParse("0.05")) ||
+		!event.Bids[1].Quantity.Equal(decimal.MustParse("2")) {
+		t.Errorf("bids = %+v, want descending", event.Bids)
+	}
+	if !event.EventTime.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("event time = %v", event.EventTime)
+	}
+
+	event = receive()
+	if event.Symbol != "BTC+USDT" || len(event.Asks) != 1 || len(event.Bids) != 1 {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestOKXBookProcessBBO(t *testing.T) {
+	var got *OrderBookEvent
+	book := &okxBook{
+		symbol:  new(OKXPublicClient).CreateSymbol("ETH+BTC"),
+		channel: "bbo-tbt",
+		local:   NewLocalOrderBook(),
+		handler: func(event *OrderBookEvent) { got = event },
+	}
+
+	book.process(&okxBookData{Asks: [][]string{{"0.0501", "1", "0", "1"}}, Bids: [][]string{{"0.05", "2", "0", "1"}}, Time: "1", Seq: 1})
+	book.process(&okxBookData{Asks: [][]string{{"0.0502", "1", "0", "1"}}, Bids: [][]string{{"0.0499", "2", "0", "1"}}, Time: "2", Seq: 2})
+
+	// every push replaces the book
+	if got == nil || len(got.Asks) != 1 || !got.Asks[0].Price.Equal(decimal.MustParse("0.0502")) ||
+		len(got.Bids) != 1 || !got.Bids[0].Price.Equal(decimal.MustParse("0.0499")) {
+		t.Errorf("event = %+v", got)
+	}
+	if book.local.Sequence != 2 {
+		t.Errorf("sequence = %d", book.local.Sequence)
+	}
+}
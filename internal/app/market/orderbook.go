@@ -0,0 +1,126 @@
+package market
+
+import (
+	"sort"
+	"tarbitrage/pkg/decimal"
+	"time"
+)
+
+// LocalOrderBook keeps both sides of an order book sorted best first: asks
+// ascending and bids descending by price.
+type LocalOrderBook struct {
+	Asks      []PriceLevel
+	Bids      []PriceLevel
+	UpdateID  int64
+	Sequence  int64
+	EventTime time.Time
+}
+
+func NewLocalOrderBook() *LocalOrderBook {
+	return &LocalOrderBook{
+		Asks: make([]PriceLevel, 0),
+		Bids: make([]PriceLevel, 0),
+	}
+}
+
+// ApplySnapshot replaces both sides with the given [price, quantity] levels.
+func (b *LocalOrderBook) ApplySnapshot(asks, bids [][]string) {
+	b.Asks = b.Asks[:0]
+	b.Bids = b.Bids[:0]
+	b.ApplyDelta(asks, bids)
+}
+
+// ApplyDelta inserts, updates or (for zero quantity) removes the given
+// [price, quantity] levels.
+func (b *LocalOrderBook) ApplyDelta(asks, bids [][]string) {
+	for _, level := range asks {
+		b.Asks = update(b.Asks, level, func(x, y decimal.Decimal) bool { return x.Cmp(y) >= 0 })
+	}
+	for _, level := range bids {
+		b.Bids = update(b.Bids, level, func(x, y decimal.Decimal) bool { return x.Cmp(y) <= 0 })
+	}
+}
+
+// Reset drops all levels, e.g. when a gap in the updates has been detected.
+func (b *LocalOrderBook) Reset() {
+	b.Asks = b.Asks[:0]
+	b.Bids = b.Bids[:0]
+	b.UpdateID = 0
+	b.Sequence = 0
+	b.EventTime = time.Time{}
+}
+
+func (b *LocalOrderBook) IsEmpty() bool {
+	return len(b.Asks) == 0 && len(b.Bids) == 0
+}
+
+// StaleEvent replaces the last event of a book which has been reset, e.g.
+// after a gap or a reconnection, so that it is not traded on until the next
+// snapshot arrives.
+func StaleEvent(symbol string) *OrderBookEvent {
+	now := time.Now()
+	return &OrderBookEvent{Symbol: symbol, Stale: true, EventTime: now, ReceiveTime: now}
+}
+
+// Event copies at most depth best levels of each side (all if depth <= 0).
+// The exchange event time falls back to the receive time when it is unknown.
+func (b *LocalOrderBook) Event(symbol string, depth int) *OrderBookEvent {
+	cut := func(levels []PriceLevel) []PriceLevel {
+		n := len(levels)
+		if depth > 0 && depth < n {
+			n = depth
+		}
+		res := make([]PriceLevel, n)
+		copy(res, levels[:n])
+		return res
+	}
+
+	received := time.Now()
+	event_time := b.EventTime
+	if event_time.IsZero() {
+		event_time = received
+	}
+
+	return &OrderBookEvent{
+		Symbol:      symbol,
+		Asks:        cut(b.Asks),
+		Bids:        cut(b.Bids),
+		EventTime:   event_time,
+		ReceiveTime: received,
+	}
+}
+
+// update applies a single level to a side sorted so that after(levels[i].Price, price)
+// holds for every level at or past the insertion point.
+func update(levels []PriceLevel, level []string, after func(x, y decimal.Decimal) bool) []PriceLevel {
+	if len(level) < 2 {
+		return levels
+	}
+	price, err := decimal.Parse(level[0])
+	if err != nil {
+		return levels
+	}
+	quantity, err := decimal.Parse(level[1])
+	if err != nil {
+		return levels
+	}
+
+	idx := sort.Search(len(levels), func(i int) bool { return after(levels[i].Price, price) })
+	found := idx < len(levels) && levels[idx].Price.Equal(price)
+
+	switch {
+	case quantity.IsZero() && found:
+		return append(levels[:idx], levels[idx+1:]...)
+	case quantity.IsZero():
+		return levels
+	case found:
+		levels[idx].Quantity = quantity
+		return levels
+	}
+
+	levels = append(levels, PriceLevel{})
+	copy(levels[idx+1:], levels[idx:])
+	levels[idx] = PriceLevel{Price: price, Quantity: quantity}
+
+	return levels
+}
@@ -0,0 +1,228 @@
+package market
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"tarbitrage/pkg/decimal"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PaperPrivateClient executes orders against the order books collected by the
+// robot instead of sending them to the exchange. Balances are virtual and may
+// become negative, which stands for an amount borrowed on margin.
+type PaperPrivateClient struct {
+	name     string
+	Key      string
+	Secret   string
+	State    *sync.Map
+	Fee      *float64
+	Logger   *logrus.Logger
+	balances map[string]float64
+	orders   map[string]*OrderResult
+	counter  int64
+	lock     sync.Mutex
+}
+
+func NewPaperPrivateClient(market, api_key, secret string, balance float64, logger *logrus.Logger) (*PaperPrivateClient, error) {
+	switch market {
+	case "BINANCE", "BYBIT", "OKX", "KRAKEN", "KUCOIN", "GATE":
+	default:
+		return nil, fmt.Errorf("unsupported market: %s", market)
+	}
+
+	return &PaperPrivateClient{
+		name:     market,
+		Key:      api_key,
+		Secret:   secret,
+		Logger:   logger,
+		balances: map[string]float64{"USDT": balance},
+		orders:   make(map[string]*OrderResult),
+	}, nil
+}
+
+func (c *PaperPrivateClient) Name() string {
+	return c.name
+}
+
+func (c *PaperPrivateClient) GetKey() string {
+	return c.Key
+}
+
+func (c *PaperPrivateClient) GetSecret() string {
+	return c.Secret
+}
+
+// SupportsShort follows the simulated exchange, so that paper trading does
+// not borrow where the real account could not.
+func (c *PaperPrivateClient) SupportsShort() bool {
+	return c.name != "KRAKEN"
+}
+
+// SyncTime is a no-op, paper orders are not signed.
+func (c *PaperPrivateClient) SyncTime() (time.Duration, error) {
+	return 0, nil
+}
+
+func (c *PaperPrivateClient) SetRecvWindow(window time.Duration) {}
+
+func (c *PaperPrivateClient) ApplyInitial(lot float64) error {
+	balance, err := c.GetMarginBalance()
+	if err != nil {
+		return err
+	}
+	if balance < lot {
+		return fmt.Errorf("you have not enough balance (should be greater than lot)")
+	}
+	return nil
+}
+
+func (c *PaperPrivateClient) GetMarginBalance() (float64, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	total := 0.0
+	for asset, amount := range c.balances {
+		total += c.valueInUSDT(asset, amount)
+	}
+
+	return total, nil
+}
+
+// GetBalances reports negative virtual balances as borrowed.
+func (c *PaperPrivateClient) GetBalances() (map[string]Balance, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	balances := make(map[string]Balance, len(c.balances))
+	for asset, amount := range c.balances {
+		if amount < 0 {
+			balances[asset] = Balance{Asset: asset, Borrowed: -amount}
+		} else {
+			balances[asset] = Balance{Asset: asset, Free: amount}
+		}
+	}
+
+	return balances, nil
+}
+
+// Repay has nothing to do: a virtual balance is either free or borrowed.
+func (c *PaperPrivateClient) Repay(asset string, amount decimal.Decimal) error {
+	return nil
+}
+
+// GetFees charges the configured fee on every symbol.
+func (c *PaperPrivateClient) GetFees(symbols []MarketSymbol) (map[string]float64, error) {
+	fees := make(map[string]float64, len(symbols))
+	for _, s := range symbols {
+		fees[s.GetBaseSymbol()] = *c.Fee
+	}
+	return fees, nil
+}
+
+func (c *PaperPrivateClient) PlaceOrder(symbol MarketSymbol, side, t string, quantity decimal.Decimal, clientID string) (*OrderResult, error) {
+	amount := quantity.Float64()
+
+	book, ok := c.loadBook(symbol.GetBaseSymbol())
+	if !ok {
+		return nil, fmt.Errorf("paper error: no order book for symbol %s", symbol.GetBaseSymbol())
+	}
+
+	var levels []PriceLevel
+	switch side {
+	case "BUY":
+		levels = book.Asks
+	case "SELL":
+		levels = book.Bids
+	default:
+		return nil, fmt.Errorf("paper error: unknown side %s", side)
+	}
+
+	var base, quote float64
+	switch t {
+	case "open":
+		base, quote, ok = FillQuote(levels, amount)
+	case "close":
+		base, quote, ok = FillBase(levels, amount)
+	default:
+		return nil, fmt.Errorf("paper error: unknown order type %s", t)
+	}
+	if !ok {
+		return nil, fmt.Errorf("paper error: not enough liquidity in %s order book", symbol.GetBaseSymbol())
+	}
+
+	rate := *c.Fee / 100.0
+	fees := make(map[string]float64)
+
+	c.lock.Lock()
+	switch side {
+	case "BUY":
+		fees[symbol.GetBaseAsset()] = base * rate
+		c.balances[symbol.GetQuoteAsset()] -= quote
+		c.balances[symbol.GetBaseAsset()] += base * (1 - rate)
+	case "SELL":
+		fees[symbol.GetQuoteAsset()] = quote * rate
+		c.balances[symbol.GetBaseAsset()] -= base
+		c.balances[symbol.GetQuoteAsset()] += quote * (1 - rate)
+	}
+	c.counter++
+	now := time.Now()
+	result := &OrderResult{
+		OrderID:       strconv.FormatInt(c.counter, 10),
+		ClientOrderID: clientID,
+		Symbol:        symbol.GetSymbol(),
+		Side:          side,
+		Status:        "FILLED",
+		ExecutedQty:   base,
+		QuoteQty:      quote,
+		AvgPrice:      quote / base,
+		Fees:          fees,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	c.orders[clientID] = result
+	c.lock.Unlock()
+
+	c.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Paper order %s %s: base %f, quote %f.", side, symbol.GetSymbol(), base, quote))
+
+	return result, nil
+}
+
+func (c *PaperPrivateClient) GetOrder(symbol MarketSymbol, clientID string) (*OrderResult, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result, ok := c.orders[clientID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return result, nil
+}
+
+func (c *PaperPrivateClient) loadBook(base_symbol string) (*OrderBookEvent, bool) {
+	value, ok := c.State.Load(base_symbol)
+	if !ok || value == nil {
+		return nil, false
+	}
+	// a stale or one sided book is not filled from, like the robot does
+	book := value.(*OrderBookEvent)
+	if book.Stale || len(book.Asks) == 0 || len(book.Bids) == 0 {
+		return nil, false
+	}
+	return book, true
+}
+
+// valueInUSDT estimates an asset amount in USDT using the best bid of the
+// ASSET+USDT order book. Assets without such a book are not counted.
+func (c *PaperPrivateClient) valueInUSDT(asset string, amount float64) float64 {
+	if asset == "USDT" {
+		return amount
+	}
+	book, ok := c.loadBook(asset + "+USDT")
+	if !ok {
+		return 0.0
+	}
+	return amount * book.Bids[0].Price.Float64()
+}
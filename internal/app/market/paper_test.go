@@ -0,0 +1,42 @@
+package market
+
+import (
+	"io"
+	"sync"
+	"tarbitrage/pkg/decimal"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestPaperRefusesStaleBook(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client, err := NewPaperPrivateClient("BINANCE", "", "", 1000, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee := 0.1
+	client.State = new(sync.Map)
+	client.Fee = &fee
+	symbol := new(BinancePublicClient).CreateSymbol("BTC+USDT")
+	symbol.SetBasePrecision(8)
+	symbol.SetPricePrecision(8)
+
+	level := []PriceLevel{{Price: decimal.MustParse("30000"), Quantity: decimal.MustParse("1")}}
+	for _, book := range []*OrderBookEvent{
+		StaleEvent("BTC+USDT"),
+		{Symbol: "BTC+USDT", Asks: level, Stale: true, Bids: level},
+		{Symbol: "BTC+USDT", Asks: level},
+	} {
+		client.State.Store("BTC+USDT", book)
+		if _, err := client.PlaceOrder(symbol, "BUY", "open", decimal.MustParse("0.001"), "paper-1"); err == nil {
+			t.Errorf("filled from the book %+v", book)
+		}
+	}
+
+	client.State.Store("BTC+USDT", &OrderBookEvent{Symbol: "BTC+USDT", Asks: level, Bids: level})
+	if _, err := client.PlaceOrder(symbol, "BUY", "open", decimal.MustParse("0.001"), "paper-2"); err != nil {
+		t.Errorf("not filled from a live book: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package robot
+
+import (
+	"fmt"
+	"math"
+	"tarbitrage/internal/app/market"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LoadBalances refreshes the cached positions of the margin account.
+func (r *Robot) LoadBalances() error {
+	balances, err := r.Private.GetBalances()
+	if err != nil {
+		return err
+	}
+
+	r.Balances.Range(func(key, value interface{}) bool {
+		if _, ok := balances[key.(string)]; !ok {
+			r.Balances.Delete(key)
+		}
+		return true
+	})
+	for asset, balance := range balances {
+		r.Balances.Store(asset, balance)
+	}
+
+	return nil
+}
+
+func (r *Robot) GetBalance(asset string) (market.Balance, bool) {
+	balance, ok := r.Balances.Load(asset)
+	if !ok {
+		return market.Balance{}, false
+	}
+	return balance.(market.Balance), true
+}
+
+// tradeLot caps the lot of a Buy, Buy, Sell sequence, which spends the start
+// asset, by its free balance, and is zero when nothing is free. The full lot
+// is traded only when the balance is unknown. Sell, Sell, Buy sells borrowed
+// assets, so it always trades the full lot.
+func (r *Robot) tradeLot(asset, sequence string) float64 {
+	if sequence != "BBS" {
+		return r.Lot
+	}
+	balance, ok := r.GetBalance(asset)
+	if !ok || balance.Free >= r.Lot {
+		return r.Lot
+	}
+	if balance.Free <= 0 {
+		return 0
+	}
+	return balance.Free
+}
+
+// checkBalances reloads the balances after an execution and reports the
+// intermediate assets left over or still borrowed.
+func (r *Robot) checkBalances(e *Execution) {
+	if err := r.LoadBalances(); err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Balances are not reloaded after execution %s: %v", e.ID, err))
+		return
+	}
+
+	e.Balances = make(map[string]market.Balance)
+	for asset, net := range e.Net {
+		// assets only paid as fees, e.g. BNB, have not been traded; they are
+		// compared with a tolerance, as the net and the fees are floats
+		if asset == e.Asset || math.Abs(net+e.Fees[asset]) < 1e-12 {
+			continue
+		}
+		balance, ok := r.GetBalance(asset)
+		if !ok {
+			continue
+		}
+		e.Balances[asset] = balance
+		if balance.Borrowed > 0 || balance.Interest > 0 {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Outstanding borrow after execution %s: %f %s, interest %f.",
+				e.ID, balance.Borrowed, asset, balance.Interest))
+		}
+		if balance.Free > 0 {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Leftover after execution %s: %f %s.", e.ID, balance.Free, asset))
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package robot
+
+import (
+	"sync"
+	"tarbitrage/internal/app/market"
+	"testing"
+)
+
+func TestTradeLot(t *testing.T) {
+	r := &Robot{Lot: 100, Balances: new(sync.Map)}
+	if lot := r.tradeLot("USDT", "BBS"); lot != 100 {
+		t.Errorf("the lot on an unknown balance is %f, want 100", lot)
+	}
+
+	for _, c := range []struct {
+		free     float64
+		sequence string
+		lot      float64
+	}{
+		{0, "BBS", 0},
+		{-1, "BBS", 0},
+		{40, "BBS", 40},
+		{500, "BBS", 100},
+		{0, "SSB", 100},
+	} {
+		r.Balances.Store("USDT", market.Balance{Free: c.free})
+		if lot := r.tradeLot("USDT", c.sequence); lot != c.lot {
+			t.Errorf("%s on %f free trades %f, want %f", c.sequence, c.free, lot, c.lot)
+		}
+	}
+}
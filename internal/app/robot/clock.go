@@ -0,0 +1,39 @@
+package robot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyncTime measures the offset of the exchange clock applied to signed
+// requests.
+func (r *Robot) SyncTime() {
+	offset, err := r.Private.SyncTime()
+	if err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Server time is not synchronized, offset stays %v: %v", offset, err))
+		return
+	}
+	r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Server time offset: %v.", offset))
+}
+
+// RunTimeSync repeats SyncTime every TimeSync.
+func (r *Robot) RunTimeSync() {
+	if r.TimeSync <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.TimeSync)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Quit:
+				return
+			case <-ticker.C:
+				r.SyncTime()
+			}
+		}
+	}()
+}
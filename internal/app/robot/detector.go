@@ -3,6 +3,8 @@ package robot
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"tarbitrage/internal/app/market"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -10,102 +12,255 @@ import (
 
 type Detector struct {
 	Triangle *Triangle
-	Fee      float64
 	Quit     chan struct{}
+	Notify   chan struct{}
+	// Detected, when set, is signalled after every detection, e.g. to measure
+	// the latency of detections.
+	Detected chan struct{}
 	Robot    *Robot
+	Skipped  atomic.Uint64
 }
 
+// Detection holds the depth-adjusted return of both sequences for the robot
+// lot and the maximal lot (in the start asset) which still beats the threshold.
+// bbsAt simulates Buy, Buy, Sell of another lot over the same books.
 type Detection struct {
-	bbs, ssb float64
+	bbs, ssb         float64
+	bbsSize, ssbSize float64
+	bbsAt            simulation
 }
 
-func arbitrage_formula(a, b, c, fee float64, sequence string) float64 {
-	var x float64
-	switch sequence {
-	case "BBS":
-		x = c/(a*b) - (fee * 3 / 100.0)
-	case "SSB":
-		x = 2.0 - c/(a*b) - (fee * 3 / 100.0)
+type simulation func(lot float64) (float64, bool)
+
+// bbs_return simulates Buy, Buy, Sell of the lot over the book levels, each
+// leg charged its own fee in percent, and returns the amount of the start
+// asset received per unit spent.
+func bbs_return(initial, middle, final *market.OrderBookEvent, lot float64, fees [3]float64) (float64, bool) {
+	var keep [3]float64
+	for i, fee := range fees {
+		keep[i] = 1 - fee/100.0
+	}
+
+	x, _, ok := market.FillQuote(initial.Asks, lot)
+	if !ok {
+		return 0.0, false
+	}
+	y, _, ok := market.FillQuote(middle.Asks, x*keep[0])
+	if !ok {
+		return 0.0, false
+	}
+	_, z, ok := market.FillBase(final.Bids, y*keep[1])
+	if !ok {
+		return 0.0, false
 	}
 
-	return x
+	return z * keep[2] / lot, true
 }
 
-func (d *Detector) get_price(symbol, side string, number int) float64 {
-	return d.Robot.GetPrice(symbol, side, number)
+// ssb_return simulates Sell, Sell, Buy of the lot over the book levels: the
+// borrowed initial base is sold for the lot and bought back through the middle
+// and final legs. It returns 1 plus the profit per unit of the lot.
+func ssb_return(initial, middle, final *market.OrderBookEvent, lot float64, fees [3]float64) (float64, bool) {
+	var keep [3]float64
+	for i, fee := range fees {
+		keep[i] = 1 - fee/100.0
+	}
+
+	x, _, ok := market.FillQuote(initial.Bids, lot)
+	if !ok {
+		return 0.0, false
+	}
+	y, _, ok := market.FillQuote(middle.Bids, x/keep[1])
+	if !ok {
+		return 0.0, false
+	}
+	_, c, ok := market.FillBase(final.Asks, y/keep[2])
+	if !ok {
+		return 0.0, false
+	}
+
+	return 1.0 + (lot*keep[0]-c)/lot, true
 }
 
-func (d *Detector) bbs(det *Detection, wg *sync.WaitGroup) {
-	defer wg.Done()
-	a := d.get_price(d.Triangle.Initial.GetBaseSymbol(), "ASK", 0)
-	b := d.get_price(d.Triangle.Middle.GetBaseSymbol(), "ASK", 0)
-	c := d.get_price(d.Triangle.Final.GetBaseSymbol(), "BID", 0)
+// max_size searches the largest lot, starting from a profitable one, for which
+// the simulated return still beats the threshold and the books are deep enough.
+func max_size(simulate simulation, lot, threshold float64) float64 {
+	profitable := func(size float64) bool {
+		x, ok := simulate(size)
+		return ok && x > 1.0+threshold
+	}
 
-	if a == 0.0 || b == 0.0 || c == 0.0 {
-		det.bbs = 0.0
-		return
+	lo, hi := lot, lot*2
+	for i := 0; i < 32 && profitable(hi); i++ {
+		lo, hi = hi, hi*2
+	}
+	for i := 0; i < 20; i++ {
+		mid := (lo + hi) / 2
+		if profitable(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
 	}
 
-	det.bbs = arbitrage_formula(a, b, c, d.Fee, "BBS")
+	return lo
+}
+
+func (d *Detector) get_books() (*market.OrderBookEvent, *market.OrderBookEvent, *market.OrderBookEvent, bool) {
+	initial, ok := d.Robot.GetBook(d.Triangle.Initial.GetBaseSymbol())
+	if !ok {
+		return nil, nil, nil, false
+	}
+	middle, ok := d.Robot.GetBook(d.Triangle.Middle.GetBaseSymbol())
+	if !ok {
+		return nil, nil, nil, false
+	}
+	final, ok := d.Robot.GetBook(d.Triangle.Final.GetBaseSymbol())
+	if !ok {
+		return nil, nil, nil, false
+	}
+	return initial, middle, final, true
 }
 
-func (d *Detector) ssb(det *Detection, wg *sync.WaitGroup) {
+// is_fresh reports whether every leg has been received within MaxBookAge and
+// the exchange times of the legs are at most MaxBookSkew apart.
+func (d *Detector) is_fresh(books ...*market.OrderBookEvent) bool {
+	now := time.Now()
+	oldest, newest := books[0].EventTime, books[0].EventTime
+	for _, book := range books {
+		if d.Robot.MaxBookAge > 0 && now.Sub(book.ReceiveTime) > d.Robot.MaxBookAge {
+			return false
+		}
+		if book.EventTime.Before(oldest) {
+			oldest = book.EventTime
+		}
+		if book.EventTime.After(newest) {
+			newest = book.EventTime
+		}
+	}
+	return d.Robot.MaxBookSkew <= 0 || newest.Sub(oldest) <= d.Robot.MaxBookSkew
+}
+
+func (d *Detector) evaluate(wg *sync.WaitGroup, simulate simulation, ret, size *float64) {
 	defer wg.Done()
-	a := d.get_price(d.Triangle.Initial.GetBaseSymbol(), "BID", 0)
-	b := d.get_price(d.Triangle.Middle.GetBaseSymbol(), "BID", 0)
-	c := d.get_price(d.Triangle.Final.GetBaseSymbol(), "ASK", 0)
+	lot := d.Robot.Lot
 
-	if a == 0.0 || b == 0.0 || c == 0.0 {
-		det.ssb = 0.0
+	x, ok := simulate(lot)
+	if !ok {
+		*ret = 0.0
 		return
 	}
+	*ret = x
 
-	det.bbs = arbitrage_formula(a, b, c, d.Fee, "SSB")
+	if x > 1.0+d.Robot.Threashold {
+		*size = max_size(simulate, lot, d.Robot.Threashold)
+	}
+}
+
+func (d *Detector) detect() *Detection {
+	detection := new(Detection)
+
+	initial, middle, final, ok := d.get_books()
+	if !ok {
+		return detection
+	}
+	if !d.is_fresh(initial, middle, final) {
+		d.Skipped.Add(1)
+		return detection
+	}
+
+	fees := [3]float64{
+		d.Robot.FeeOf(d.Triangle.Initial.GetBaseSymbol()),
+		d.Robot.FeeOf(d.Triangle.Middle.GetBaseSymbol()),
+		d.Robot.FeeOf(d.Triangle.Final.GetBaseSymbol()),
+	}
+
+	bbs := func(lot float64) (float64, bool) {
+		return bbs_return(initial, middle, final, lot, fees)
+	}
+	ssb := func(lot float64) (float64, bool) {
+		return ssb_return(initial, middle, final, lot, fees)
+	}
+
+	detection.bbsAt = bbs
+
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	go d.evaluate(wg, bbs, &detection.bbs, &detection.bbsSize)
+	go d.evaluate(wg, ssb, &detection.ssb, &detection.ssbSize)
+	wg.Wait()
+
+	return detection
 }
 
 func (d *Detector) Run() {
 	go func() {
 		possibility := 0.0
-		ticker := time.NewTicker(time.Millisecond * 100)
-		defer ticker.Stop()
 		for {
 			select {
 			case <-d.Quit:
-				d.Robot.logger.Log(logrus.InfoLevel, d.Triangle.Repr(), "is stopped.")
+				d.Robot.logger.Log(logrus.InfoLevel, d.Triangle.Repr(), "is stopped,", d.Skipped.Load(), "evaluations skipped on outdated books.")
 				return
-			case <-ticker.C:
-				detection := new(Detection)
-				wg := new(sync.WaitGroup)
-				wg.Add(2)
-				go d.bbs(detection, wg)
-				go d.ssb(detection, wg)
-				wg.Wait()
+			case <-d.Notify:
+				detection := d.detect()
+				if d.Detected != nil {
+					select {
+					case d.Detected <- struct{}{}:
+					case <-d.Quit:
+						return
+					}
+				}
 
 				if detection.bbs > 1.0+d.Robot.Threashold {
 					cur := (detection.bbs - 1.0) * 100
 					if possibility != cur {
 						possibility = cur
 						d.Robot.logger.Log(logrus.InfoLevel,
-							fmt.Sprintf("Find arbitrage possibility %s (Buy, Buy, Sell), Percent: %.2f\n", d.Triangle.Repr(), possibility))
+							fmt.Sprintf("Find arbitrage possibility %s (Buy, Buy, Sell), Percent: %.2f, Max size: %.2f\n",
+								d.Triangle.Repr(), possibility, detection.bbsSize))
 						if d.Robot.Exec.Counter >= 3 {
 							continue
 						}
-						if err := d.Robot.Exec.ExecuteTriangle(d.Triangle, "BBS", d.Robot.Lot); err != nil {
+						lot, expected := d.Robot.tradeLot(d.Triangle.Initial.GetQuoteAsset(), "BBS"), detection.bbs
+						if lot <= 0 {
+							d.Robot.logger.Log(logrus.InfoLevel,
+								fmt.Sprintf("Skip %s (Buy, Buy, Sell): no free %s to trade.\n",
+									d.Triangle.Repr(), d.Triangle.Initial.GetQuoteAsset()))
+							continue
+						}
+						if lot < d.Robot.Lot {
+							// the lot is capped by the free balance, so it has to beat
+							// the threshold on its own
+							x, ok := detection.bbsAt(lot)
+							if !ok || x <= 1.0+d.Robot.Threashold {
+								d.Robot.logger.Log(logrus.InfoLevel,
+									fmt.Sprintf("Skip %s (Buy, Buy, Sell): lot capped to %f by the free balance returns %.4f.\n",
+										d.Triangle.Repr(), lot, x))
+								continue
+							}
+							expected = x
+						}
+						execution, err := d.Robot.Exec.ExecuteTriangle(d.Triangle, "BBS", lot, expected)
+						if err != nil {
 							d.Robot.logger.Log(logrus.InfoLevel, err)
 						}
+						d.Robot.record(execution)
 					}
-				} else if detection.ssb > 1.0+d.Robot.Threashold {
-					cur := (detection.bbs - 1.0) * 100
+				} else if detection.ssb > 1.0+d.Robot.Threashold && d.Robot.Private.SupportsShort() {
+					cur := (detection.ssb - 1.0) * 100
 					if possibility != cur {
 						possibility = cur
 						d.Robot.logger.Log(logrus.InfoLevel,
-							fmt.Sprintf("Find arbitrage possibility %s (Sell, Sell, Buy), Percent: %.2f\n", d.Triangle.Repr(), possibility))
+							fmt.Sprintf("Find arbitrage possibility %s (Sell, Sell, Buy), Percent: %.2f, Max size: %.2f\n",
+								d.Triangle.Repr(), possibility, detection.ssbSize))
 						if d.Robot.Exec.Counter >= 3 {
 							continue
 						}
-						if err := d.Robot.Exec.ExecuteTriangle(d.Triangle, "SSB", d.Robot.Lot); err != nil {
+						execution, err := d.Robot.Exec.ExecuteTriangle(d.Triangle, "SSB", d.Robot.tradeLot(d.Triangle.Initial.GetQuoteAsset(), "SSB"), detection.ssb)
+						if err != nil {
 							d.Robot.logger.Log(logrus.InfoLevel, err)
 						}
+						d.Robot.record(execution)
 					}
 				} else {
 					possibility = 0.0
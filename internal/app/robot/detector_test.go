@@ -0,0 +1,109 @@
+package robot
+
+import (
+	"math/rand"
+	"tarbitrage/internal/app/market"
+	"testing"
+	"time"
+)
+
+// tickerInterval is the polling period of the detectors before they were
+// woken by order book updates.
+const tickerInterval = 100 * time.Millisecond
+
+// benchDetector returns a detector over BTC+USDT, ETH+BTC and ETH+USDT with
+// books which never beat the threshold, so that detect never executes.
+func benchDetector(b *testing.B) *Detector {
+	r := testRobot(b,
+		benchBook("BTC+USDT", "30000", "29999"),
+		benchBook("ETH+BTC", "0.06", "0.0599"),
+		benchBook("ETH+USDT", "1800", "1799"))
+	triangle := &Triangle{
+		Initial: r.Symbols["BTC+USDT"],
+		Middle:  r.Symbols["ETH+BTC"],
+		Final:   r.Symbols["ETH+USDT"],
+	}
+
+	d := &Detector{
+		Triangle: triangle,
+		Quit:     make(chan struct{}),
+		Notify:   make(chan struct{}, 1),
+		Robot:    r,
+	}
+	for _, symbol := range []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final} {
+		r.Watchers[symbol.GetBaseSymbol()] = append(r.Watchers[symbol.GetBaseSymbol()], d)
+	}
+	return d
+}
+
+// benchUpdate stores a new ETH+BTC book, as the depth handler does.
+func benchUpdate(r *Robot) *market.OrderBookEvent {
+	event := benchBook("ETH+BTC", "0.06", "0.0599")
+	r.State.Store(event.Symbol, event)
+	return event
+}
+
+// BenchmarkDetectNotify measures the time from an order book update to the
+// detection over it with detectors woken by the update.
+func BenchmarkDetectNotify(b *testing.B) {
+	d := benchDetector(b)
+	d.Detected = make(chan struct{})
+	d.Run()
+	defer close(d.Quit)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		event := benchUpdate(d.Robot)
+		d.Robot.notify(event.Symbol)
+		<-d.Detected
+	}
+}
+
+// BenchmarkDetectTicker measures the same latency with detectors polling the
+// books every tickerInterval. Updates arrive at a random point of the
+// interval, as they do from the exchange.
+func BenchmarkDetectTicker(b *testing.B) {
+	d := benchDetector(b)
+	detected := make(chan *market.OrderBookEvent)
+
+	go func() {
+		ticker := time.NewTicker(tickerInterval)
+		defer ticker.Stop()
+		var last *market.OrderBookEvent
+		for {
+			select {
+			case <-d.Quit:
+				return
+			case <-ticker.C:
+				current, _ := d.Robot.GetBook("ETH+BTC")
+				d.detect()
+				if current != last {
+					last = current
+					select {
+					case detected <- current:
+					case <-d.Quit:
+						return
+					}
+				}
+			}
+		}
+	}()
+	defer close(d.Quit)
+
+	// the books stored by benchDetector are seen once
+	<-detected
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		time.Sleep(time.Duration(rand.Int63n(int64(tickerInterval))))
+		b.StartTimer()
+
+		event := benchUpdate(d.Robot)
+		for current := range detected {
+			if current == event {
+				break
+			}
+		}
+	}
+}
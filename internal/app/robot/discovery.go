@@ -0,0 +1,144 @@
+package robot
+
+import (
+	"fmt"
+	"sort"
+	"tarbitrage/internal/app/market"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Discovery configures triangle generation from the exchange instrument list.
+// Logger, when set, reports the quote assets without a USDT price.
+type Discovery struct {
+	Anchors    []string
+	MinVolume  float64
+	MarginOnly bool
+	Logger     *logrus.Logger
+}
+
+// DiscoverTriangles enumerates every triangle START -> X -> Y -> START the
+// executor can trade, i.e. X+START, Y+X and Y+START are all listed, for each
+// anchor asset. MinVolume is the minimal 24h volume of every pair in USDT;
+// pairs whose quote asset has no USDT price, not even through BTC, are kept.
+func DiscoverTriangles(instruments []market.Instrument, d Discovery) ([]string, [][3]string) {
+	pairs := make(map[string]market.Instrument)
+	for _, inst := range instruments {
+		pairs[inst.BaseAsset+"+"+inst.QuoteAsset] = inst
+	}
+
+	// price is the last price of the asset in the quote, from either pair
+	price := func(asset, quote string) float64 {
+		if asset == quote {
+			return 1.0
+		}
+		if last := pairs[asset+"+"+quote].LastPrice; last > 0 {
+			return last
+		}
+		if last := pairs[quote+"+"+asset].LastPrice; last > 0 {
+			return 1.0 / last
+		}
+		return 0.0
+	}
+
+	priceInUSDT := func(asset string) float64 {
+		if direct := price(asset, "USDT"); direct > 0 {
+			return direct
+		}
+		return price(asset, "BTC") * price("BTC", "USDT")
+	}
+
+	unpriced := make(map[string]bool)
+	byQuote := make(map[string][]market.Instrument)
+	for _, inst := range instruments {
+		if d.MarginOnly && !inst.Margin {
+			continue
+		}
+		if d.MinVolume > 0 {
+			quote := priceInUSDT(inst.QuoteAsset)
+			if quote <= 0 && !unpriced[inst.QuoteAsset] {
+				unpriced[inst.QuoteAsset] = true
+				if d.Logger != nil {
+					d.Logger.Log(logrus.InfoLevel, fmt.Sprintf("Discovery: no USDT price for %s, its pairs are kept regardless of volume.", inst.QuoteAsset))
+				}
+			}
+			if quote > 0 && inst.QuoteVolume*quote < d.MinVolume {
+				continue
+			}
+		}
+		byQuote[inst.QuoteAsset] = append(byQuote[inst.QuoteAsset], inst)
+	}
+
+	eligible := make(map[string]bool)
+	for _, list := range byQuote {
+		for _, inst := range list {
+			eligible[inst.BaseAsset+"+"+inst.QuoteAsset] = true
+		}
+	}
+
+	triangles := make([][3]string, 0)
+	used := make(map[string]bool)
+
+	for _, start := range d.Anchors {
+		for _, initial := range byQuote[start] {
+			x := initial.BaseAsset
+			for _, middle := range byQuote[x] {
+				y := middle.BaseAsset
+				if y == start {
+					continue
+				}
+				final := y + "+" + start
+				if !eligible[final] {
+					continue
+				}
+				triangle := [3]string{x + "+" + start, y + "+" + x, final}
+				triangles = append(triangles, triangle)
+				for _, s := range triangle {
+					used[s] = true
+				}
+			}
+		}
+	}
+
+	sort.Slice(triangles, func(i, j int) bool {
+		for k := 0; k < 3; k++ {
+			if triangles[i][k] != triangles[j][k] {
+				return triangles[i][k] < triangles[j][k]
+			}
+		}
+		return false
+	})
+
+	symbols := make([]string, 0, len(used))
+	for s := range used {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+
+	return symbols, triangles
+}
+
+func (r *Robot) discoverTriangles() error {
+	instruments, err := r.Public.GetSpotInstruments()
+	if err != nil {
+		return err
+	}
+
+	discovery := *r.Discovery
+	discovery.Logger = r.logger
+	symbols, triangles := DiscoverTriangles(instruments, discovery)
+
+	for _, base_symbol := range symbols {
+		r.Symbols[base_symbol] = r.Public.CreateSymbol(base_symbol)
+	}
+
+	for _, t := range triangles {
+		r.Triangles = append(r.Triangles, &Triangle{
+			Initial: r.Symbols[t[0]],
+			Middle:  r.Symbols[t[1]],
+			Final:   r.Symbols[t[2]],
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package robot
+
+import (
+	"tarbitrage/internal/app/market"
+	"testing"
+)
+
+func TestDiscoverTrianglesVolume(t *testing.T) {
+	inst := func(base, quote string, last, volume float64) market.Instrument {
+		return market.Instrument{BaseAsset: base, QuoteAsset: quote, LastPrice: last, QuoteVolume: volume}
+	}
+	instruments := []market.Instrument{
+		inst("BTC", "USDT", 30000, 1e9),
+		inst("ETH", "BTC", 0.06, 1000),
+		inst("LTC", "BTC", 0.002, 1000),
+		// EUR has no USDT pair, it is priced over BTC+EUR and BTC+USDT
+		inst("BTC", "EUR", 27000, 1e9),
+		inst("ETH", "EUR", 1620, 1e9),
+		inst("LTC", "EUR", 54, 100),
+		// XYZ has no price at all, so the volume of its pairs is unknown
+		inst("ETH", "XYZ", 3, 1),
+		inst("LTC", "XYZ", 0.1, 1),
+		inst("LTC", "ETH", 0.033, 1e5),
+	}
+
+	_, triangles := DiscoverTriangles(instruments, Discovery{Anchors: []string{"EUR", "XYZ"}, MinVolume: 1e6})
+
+	found := make(map[[3]string]bool)
+	for _, triangle := range triangles {
+		found[triangle] = true
+	}
+
+	tests := []struct {
+		triangle [3]string
+		want     bool
+	}{
+		{[3]string{"BTC+EUR", "ETH+BTC", "ETH+EUR"}, true},
+		{[3]string{"BTC+EUR", "LTC+BTC", "LTC+EUR"}, false},
+		{[3]string{"ETH+XYZ", "LTC+ETH", "LTC+XYZ"}, true},
+	}
+
+	for _, tt := range tests {
+		if found[tt.triangle] != tt.want {
+			t.Errorf("triangle %v found %v, want %v", tt.triangle, found[tt.triangle], tt.want)
+		}
+	}
+}
@@ -1,80 +1,214 @@
 package robot
 
 import (
-	"strconv"
+	"fmt"
 	"sync"
 	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/decimal"
 )
 
 type Executor struct {
 	Client  market.PrivateClient
+	Journal *Journal
+	Unwind  UnwindPolicy
+	Books   func(base_symbol string) (*market.OrderBookEvent, bool)
+	// Busy is held for reading by every execution, so housekeeping can wait
+	// until no legs are in flight.
+	Busy    sync.RWMutex
 	Lock    sync.Mutex
 	Counter int
-	Fee     *float64
 }
 
-func (ex *Executor) ExecuteTriangle(triangle *Triangle, sequence string, lot float64) error {
+func (ex *Executor) journal(entry *JournalEntry) error {
+	if ex.Journal == nil {
+		return nil
+	}
+	return ex.Journal.Write(entry)
+}
+
+// order journals the intent, places the order under a client id derived from
+// the execution and journals the result. The fill is added to the legs of the
+// execution or, for a rollback, to its rollbacks.
+func (ex *Executor) order(execution *Execution, rollback bool, symbol market.MarketSymbol, side, t string,
+	quantity float64, precision int) (*market.OrderResult, error) {
+	ex.Lock.Lock()
+	defer ex.Lock.Unlock()
+
+	// quantities are truncated, and base ones cut to the step size, so that
+	// they never exceed the amount held as rounding could
+	qty := decimal.FromFloat(quantity).Truncate(precision)
+	if t == "close" {
+		qty = symbol.GetFilters().RoundQty(qty)
+	}
+
+	execution.orders++
+	clientID := fmt.Sprintf("%s-%d", execution.ID, execution.orders)
+
+	list := &execution.Legs
+	if rollback {
+		list = &execution.Rollbacks
+	}
+
+	// a quantity out of range saturates and is refused, like a zero one,
+	// before anything is sent
+	var err error
+	if qty.Sign() <= 0 || qty.Equal(decimal.Max) {
+		err = fmt.Errorf("%s %s quantity %v is out of range", side, symbol.GetBaseSymbol(), quantity)
+	} else {
+		err = ex.journal(&JournalEntry{
+			Execution: execution.ID,
+			Event:     "intent",
+			Symbol:    symbol.GetBaseSymbol(),
+			Side:      side,
+			Type:      t,
+			Quantity:  qty.String(),
+			ClientID:  clientID,
+			Rollback:  rollback,
+		})
+	}
+	var result *market.OrderResult
+	if err == nil {
+		result, err = ex.Client.PlaceOrder(symbol, side, t, qty, clientID)
+	}
+	if err != nil {
+		if rollback {
+			*list = append(*list, Fill{Symbol: symbol.GetSymbol(), Side: side, Type: t, Quantity: quantity, Error: err.Error()})
+		} else {
+			execution.Error = err.Error()
+		}
+		return nil, err
+	}
+
+	// the order is placed already, a lost result is fetched again on recovery
+	ex.journal(&JournalEntry{Execution: execution.ID, Event: "result", ClientID: clientID, Result: result})
+	execution.add(list, symbol, t, result)
+
+	return result, nil
+}
+
+// ExecuteTriangle places the three legs of the sequence, sizing every leg from
+// the amounts actually filled by the previous one. When a leg fails, the
+// unwind policy trades the filled legs back to the start asset. The returned
+// execution holds every filled leg and rollback order, also on error.
+func (ex *Executor) ExecuteTriangle(triangle *Triangle, sequence string, lot, expected float64) (*Execution, error) {
+	ex.Busy.RLock()
+	defer ex.Busy.RUnlock()
+
 	ex.Counter++
-	fee := *(ex.Fee)
 	defer func() { ex.Counter-- }()
 
-	var rollback [2]string
+	initial, middle, final := triangle.Initial, triangle.Middle, triangle.Final
+
+	if err := ex.validate(triangle, sequence, lot); err != nil {
+		return NewExecution(ex.Client.Name(), triangle.Repr(), sequence, initial.GetQuoteAsset(), lot, expected), err
+	}
+
+	execution := NewExecution(ex.Client.Name(), triangle.Repr(), sequence, initial.GetQuoteAsset(), lot, expected)
+
+	err := ex.journal(&JournalEntry{
+		Execution: execution.ID,
+		Event:     "begin",
+		Triangle:  execution.Triangle,
+		Sequence:  sequence,
+		Asset:     execution.Asset,
+		Lot:       lot,
+		Expected:  expected,
+	})
+	if err != nil {
+		return execution, err
+	}
+
+	leg := func(symbol market.MarketSymbol, side, t string, quantity float64, precision int) (*market.OrderResult, error) {
+		return ex.order(execution, false, symbol, side, t, quantity, precision)
+	}
+
 	switch sequence {
 	case "BBS":
-		quantity := strconv.FormatFloat(lot, 'f', triangle.Initial.GetPricePrecision(), 64)
-		ex.Lock.Lock()
-		qty, err := ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "BUY", "open", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
-			return err
-		}
-		quantity = strconv.FormatFloat(qty, 'f', triangle.Middle.GetPricePrecision(), 64)
-		rollback[0] = quantity
-		ex.Lock.Lock()
-		qty, err = ex.Client.PlaceOrder(triangle.Middle.GetSymbol(), "BUY", "open", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
-			ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "SELL", "close", rollback[0])
+		err = func() error {
+			first, err := leg(initial, "BUY", "open", lot, initial.GetPricePrecision())
+			if err != nil {
+				return err
+			}
+			second, err := leg(middle, "BUY", "open", first.Received(initial), middle.GetPricePrecision())
+			if err != nil {
+				return err
+			}
+			_, err = leg(final, "SELL", "close", second.Received(middle), final.GetBasePrecision())
 			return err
-		}
-		quantity = strconv.FormatFloat(qty, 'f', triangle.Middle.GetBasePrecision(), 64)
-		rollback[1] = quantity
-		ex.Lock.Lock()
-		_, err = ex.Client.PlaceOrder(triangle.Final.GetSymbol(), "SELL", "close", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
-			ex.Client.PlaceOrder(triangle.Middle.GetSymbol(), "SELL", "close", rollback[1])
-			ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "SELL", "close", rollback[0])
-			return err
-		}
+		}()
 	case "SSB":
-		quantity := strconv.FormatFloat(lot, 'f', triangle.Initial.GetPricePrecision(), 64)
-		ex.Lock.Lock()
-		qty, err := ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "SELL", "open", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
+		err = func() error {
+			first, err := leg(initial, "SELL", "open", lot, initial.GetPricePrecision())
+			if err != nil {
+				return err
+			}
+			// the borrowed base has to be bought back net of the fee withheld from
+			// the proceeds, so the next legs are grossed up by the observed rate
+			x := first.Spent(initial)
+			second, err := leg(middle, "SELL", "open", x/(1-first.FeeRate(initial)), middle.GetPricePrecision())
+			if err != nil {
+				return err
+			}
+			y := second.Spent(middle)
+			_, err = leg(final, "BUY", "close", y/(1-second.FeeRate(middle)), final.GetBasePrecision())
 			return err
+		}()
+	}
+
+	// the execution is settled only once it is flat, otherwise it stays
+	// pending in the journal and is unwound again on recovery
+	flat := true
+	if err != nil && len(execution.Legs) > 0 {
+		flat = ex.Unwind != nil && ex.Unwind.Unwind(ex, execution, triangle) == nil && len(execution.Residue) == 0
+	}
+	if flat {
+		ex.journal(&JournalEntry{Execution: execution.ID, Event: "end"})
+	} else {
+		ex.journal(&JournalEntry{Execution: execution.ID, Event: "unwind_failed"})
+	}
+
+	return execution, err
+}
+
+// validate estimates the quantities of the legs over the books, disregarding
+// fees, and checks them against the filters of the symbols, so that no leg is
+// rejected by the exchange after the first one has been filled.
+func (ex *Executor) validate(triangle *Triangle, sequence string, lot float64) error {
+	if ex.Books == nil {
+		return nil
+	}
+
+	symbols := []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final}
+	books := make([]*market.OrderBookEvent, 3)
+	for i, symbol := range symbols {
+		book, ok := ex.Books(symbol.GetBaseSymbol())
+		if !ok {
+			return fmt.Errorf("no order book for %s", symbol.GetBaseSymbol())
 		}
-		qty = qty * (1 + fee/100)
-		quantity = strconv.FormatFloat(qty, 'f', triangle.Middle.GetPricePrecision(), 64)
-		rollback[0] = quantity
-		ex.Lock.Lock()
-		qty, err = ex.Client.PlaceOrder(triangle.Middle.GetSymbol(), "SELL", "open", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
-			ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "BUY", "close", rollback[0])
-			return err
+		books[i] = book
+	}
+
+	var base, quote [3]float64
+	var ok [3]bool
+	switch sequence {
+	case "BBS":
+		base[0], quote[0], ok[0] = market.FillQuote(books[0].Asks, lot)
+		base[1], quote[1], ok[1] = market.FillQuote(books[1].Asks, base[0])
+		base[2], quote[2], ok[2] = market.FillBase(books[2].Bids, base[1])
+	case "SSB":
+		base[0], quote[0], ok[0] = market.FillQuote(books[0].Bids, lot)
+		base[1], quote[1], ok[1] = market.FillQuote(books[1].Bids, base[0])
+		base[2], quote[2], ok[2] = market.FillBase(books[2].Asks, base[1])
+	default:
+		return fmt.Errorf("unknown sequence %s", sequence)
+	}
+
+	for i, symbol := range symbols {
+		if !ok[i] {
+			return fmt.Errorf("not enough liquidity in %s order book", symbol.GetBaseSymbol())
 		}
-		qty = qty * (1 + fee/100)
-		quantity = strconv.FormatFloat(qty, 'f', triangle.Middle.GetBasePrecision(), 64)
-		rollback[1] = quantity
-		ex.Lock.Lock()
-		_, err = ex.Client.PlaceOrder(triangle.Final.GetSymbol(), "BUY", "close", quantity)
-		ex.Lock.Unlock()
-		if err != nil {
-			ex.Client.PlaceOrder(triangle.Middle.GetSymbol(), "BUY", "close", rollback[1])
-			ex.Client.PlaceOrder(triangle.Initial.GetSymbol(), "BUY", "close", rollback[0])
-			return err
+		if err := symbol.GetFilters().Check(decimal.FromFloat(base[i]), decimal.FromFloat(quote[i])); err != nil {
+			return fmt.Errorf("%s %s leg rejected: %v", triangle.Repr(), symbol.GetBaseSymbol(), err)
 		}
 	}
 
@@ -0,0 +1,110 @@
+package robot
+
+import (
+	"errors"
+	"path/filepath"
+	"tarbitrage/internal/app/market"
+	"testing"
+	"time"
+)
+
+// failingUnwind leaves the execution as it is, like an unwind whose orders
+// are all rejected.
+type failingUnwind struct{}
+
+func (failingUnwind) Unwind(ex *Executor, execution *Execution, triangle *Triangle) error {
+	execution.Residue = map[string]float64{"BTC": execution.Net["BTC"]}
+	return errors.New("rejected")
+}
+
+// executorRobot trades BTC+USDT->ETH+BTC->ETH+USDT on a paper account which
+// has no ETH+BTC book, so every execution fails after its first leg.
+func executorRobot(t *testing.T) *Robot {
+	return testRobot(t, benchBook("BTC+USDT", "30000", "29990"), benchBook("ETH+USDT", "1800", "1799"))
+}
+
+func executorTriangle() *Triangle {
+	public := new(market.BinancePublicClient)
+	triangle := &Triangle{
+		Initial: public.CreateSymbol("BTC+USDT"),
+		Middle:  public.CreateSymbol("ETH+BTC"),
+		Final:   public.CreateSymbol("ETH+USDT"),
+	}
+	for _, symbol := range []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final} {
+		symbol.SetBasePrecision(8)
+		symbol.SetPricePrecision(8)
+	}
+	return triangle
+}
+
+func TestExecuteTriangleUnwound(t *testing.T) {
+	r := executorRobot(t)
+
+	execution, err := r.Exec.ExecuteTriangle(executorTriangle(), "BBS", 100, 1.01)
+	if err == nil {
+		t.Fatal("the second leg has been filled without a book")
+	}
+	if len(execution.Rollbacks) == 0 || len(execution.Residue) > 0 {
+		t.Fatalf("the first leg is not unwound: rollbacks %v, residue %v", execution.Rollbacks, execution.Residue)
+	}
+
+	pending, err := r.Exec.Journal.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) > 0 {
+		t.Errorf("a flat execution is pending: %d entries", len(pending[0]))
+	}
+}
+
+func TestExecuteTriangleUnwindFailed(t *testing.T) {
+	r := executorRobot(t)
+	r.Exec.Unwind = failingUnwind{}
+
+	execution, err := r.Exec.ExecuteTriangle(executorTriangle(), "BBS", 100, 1.01)
+	if err == nil {
+		t.Fatal("the second leg has been filled without a book")
+	}
+
+	pending, err := r.Exec.Journal.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0][0].Execution != execution.ID {
+		t.Fatalf("the execution left with a residue is not pending: %v", pending)
+	}
+	last := pending[0][len(pending[0])-1]
+	if last.Event != "unwind_failed" {
+		t.Errorf("the last journal entry is %q, want unwind_failed", last.Event)
+	}
+}
+
+func TestLedgerReplacesRecovered(t *testing.T) {
+	ledger := NewLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+
+	first := NewExecution("BINANCE", "BTC+USDT->ETH+BTC->ETH+USDT", "BBS", "USDT", 100, 1.01)
+	first.Error = "rejected"
+	first.PnLUSDT = -5
+	second := NewExecution("BINANCE", "BTC+USDT->ETH+BTC->ETH+USDT", "BBS", "USDT", 100, 1.01)
+	second.Time = first.Time.Add(time.Second)
+	recovered := *first
+	recovered.Error = "unwind resumed after restart"
+	recovered.PnLUSDT = -0.5
+
+	for _, e := range []*Execution{first, second, &recovered} {
+		if err := ledger.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	executions, err := ledger.Read(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executions) != 2 {
+		t.Fatalf("read %d executions, want 2", len(executions))
+	}
+	if executions[0].ID != first.ID || executions[0].PnLUSDT != -0.5 {
+		t.Errorf("the recovered execution does not replace the first entry: %+v", executions[0])
+	}
+}
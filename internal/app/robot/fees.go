@@ -0,0 +1,66 @@
+package robot
+
+import (
+	"fmt"
+	"tarbitrage/internal/app/market"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FeeOf is the taker fee of the symbol in percent as loaded from the exchange,
+// or the configured Fee when it is unknown.
+func (r *Robot) FeeOf(base_symbol string) float64 {
+	if fee, ok := r.Fees.Load(base_symbol); ok {
+		return fee.(float64)
+	}
+	return r.Fee
+}
+
+func (r *Robot) loadFees() error {
+	symbols := make([]market.MarketSymbol, 0, len(r.Symbols))
+	for _, symbol := range r.Symbols {
+		symbols = append(symbols, symbol)
+	}
+
+	fees, err := r.Private.GetFees(symbols)
+	if err != nil {
+		return err
+	}
+
+	for base_symbol, fee := range fees {
+		r.Fees.Store(base_symbol, fee)
+	}
+
+	return nil
+}
+
+// LoadFees loads the fee rates; symbols the exchange reports no fee for are
+// charged the configured Fee.
+func (r *Robot) LoadFees() {
+	if err := r.loadFees(); err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Fee rates are not loaded, using %.4f%%: %v", r.Fee, err))
+	}
+}
+
+// RunFees reloads the fee rates every FeeRefresh.
+func (r *Robot) RunFees() {
+	if r.FeeRefresh <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.FeeRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Quit:
+				return
+			case <-ticker.C:
+				if err := r.loadFees(); err != nil {
+					r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Fee rates are not reloaded: %v", err))
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,251 @@
+package robot
+
+import (
+	"fmt"
+	"math"
+	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/decimal"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RunHousekeeping repays the margin liabilities left by failed or partially
+// filled executions every Housekeeping period.
+func (r *Robot) RunHousekeeping() {
+	if r.Housekeeping <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.Housekeeping)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Quit:
+				return
+			case <-ticker.C:
+				r.housekeep()
+			}
+		}
+	}()
+}
+
+// InterestPaid is the margin interest repaid by housekeeping per asset.
+func (r *Robot) InterestPaid() map[string]float64 {
+	paid := make(map[string]float64)
+	r.interest.Range(func(key, value interface{}) bool {
+		paid[key.(string)] = value.(float64)
+		return true
+	})
+	return paid
+}
+
+func (r *Robot) liabilities() map[string]market.Balance {
+	result := make(map[string]market.Balance)
+	r.Balances.Range(func(key, value interface{}) bool {
+		balance := value.(market.Balance)
+		if balance.Borrowed > 0 || balance.Interest > 0 {
+			result[key.(string)] = balance
+		}
+		return true
+	})
+	return result
+}
+
+// housekeep buys what the free balances lack to cover the liabilities, with
+// recorded residues sold when needed, repays them and reports the interest
+// paid. Executions are held off meanwhile, as their legs borrow on purpose.
+func (r *Robot) housekeep() {
+	r.Exec.Busy.Lock()
+	defer r.Exec.Busy.Unlock()
+
+	if err := r.LoadBalances(); err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: balances are not loaded: %v", err))
+		return
+	}
+
+	before := r.liabilities()
+	if len(before) == 0 {
+		return
+	}
+
+	for asset, balance := range before {
+		if debt := balance.Borrowed + balance.Interest; balance.Free < debt {
+			if err := r.cover(asset, debt-balance.Free); err != nil {
+				r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: %f %s is not bought: %v", debt-balance.Free, asset, err))
+			}
+		}
+	}
+
+	if err := r.LoadBalances(); err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: balances are not loaded: %v", err))
+		return
+	}
+
+	for asset := range before {
+		balance, _ := r.GetBalance(asset)
+		amount := balance.Borrowed + balance.Interest
+		if balance.Free < amount {
+			amount = balance.Free
+		}
+		if amount <= 0 {
+			continue
+		}
+		if err := r.Private.Repay(asset, decimal.FromFloat(amount)); err != nil {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: %f %s is not repaid: %v", amount, asset, err))
+		}
+	}
+
+	if err := r.LoadBalances(); err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: balances are not loaded: %v", err))
+		return
+	}
+
+	for asset, previous := range before {
+		balance, _ := r.GetBalance(asset)
+		repaid := previous.Borrowed - balance.Borrowed
+		interest := previous.Interest - balance.Interest
+		if interest > 0 {
+			total, _ := r.interest.LoadOrStore(asset, 0.0)
+			r.interest.Store(asset, total.(float64)+interest)
+		}
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: repaid %f %s, interest paid %f, still borrowed %f.",
+			repaid, asset, interest, balance.Borrowed+balance.Interest))
+	}
+}
+
+// cover buys the amount of the asset with the quote asset of a traded symbol
+// which has enough free balance, e.g. the residual start asset. When none has,
+// recorded residues are sold first.
+func (r *Robot) cover(asset string, amount float64) error {
+	if r.buyDebt(asset, amount) {
+		return nil
+	}
+
+	if !r.sellResidue(asset, amount) {
+		return fmt.Errorf("no symbol to buy %s with", asset)
+	}
+	if err := r.LoadBalances(); err != nil {
+		return err
+	}
+	if !r.buyDebt(asset, amount) {
+		return fmt.Errorf("no symbol to buy %s with", asset)
+	}
+	return nil
+}
+
+// buyDebt reports whether the amount of the asset has been bought.
+func (r *Robot) buyDebt(asset string, amount float64) bool {
+	for _, symbol := range r.Symbols {
+		if symbol.GetBaseAsset() != asset {
+			continue
+		}
+		price := r.GetPrice(symbol.GetBaseSymbol(), "ASK", 0)
+		quote, ok := r.GetBalance(symbol.GetQuoteAsset())
+		if price <= 0 || !ok || quote.Free < amount*price*1.01 {
+			continue
+		}
+
+		quantity := amount / (1 - r.FeeOf(symbol.GetBaseSymbol())/100.0)
+		return r.repayOrder(symbol, "BUY", quantity) != nil
+	}
+	return false
+}
+
+// trackResidue keeps the amounts an execution has been left holding, which
+// housekeeping may sell, and the assets it has only paid fees in, e.g. BNB,
+// which are never sold.
+func (r *Robot) trackResidue(e *Execution) {
+	for asset, amount := range e.Residue {
+		if amount > 0 {
+			total, _ := r.residues.LoadOrStore(asset, 0.0)
+			r.residues.Store(asset, total.(float64)+amount)
+		}
+	}
+	for asset, fee := range e.Fees {
+		if math.Abs(e.Net[asset]+fee) < 1e-12 {
+			r.feeAssets.Store(asset, true)
+		}
+	}
+}
+
+// sellResidue sells the recorded residues for the quote asset of a symbol the
+// asset can be bought over, only as much as buying the amount lacks. It
+// reports whether anything has been sold.
+func (r *Robot) sellResidue(asset string, amount float64) bool {
+	for _, target := range r.Symbols {
+		if target.GetBaseAsset() != asset {
+			continue
+		}
+		quote := target.GetQuoteAsset()
+		ask := r.GetPrice(target.GetBaseSymbol(), "ASK", 0)
+		if ask <= 0 {
+			continue
+		}
+		balance, _ := r.GetBalance(quote)
+		// a margin over the one of buyDebt covers the rounding of the sales
+		lack := amount*ask*1.02 - balance.Free
+
+		sold := false
+		for _, symbol := range r.Symbols {
+			residual := symbol.GetBaseAsset()
+			if lack <= 0 {
+				break
+			}
+			if symbol.GetQuoteAsset() != quote || residual == asset {
+				continue
+			}
+			if _, fee := r.feeAssets.Load(residual); fee {
+				continue
+			}
+			recorded, ok := r.residues.Load(residual)
+			if !ok {
+				continue
+			}
+			held, ok := r.GetBalance(residual)
+			if !ok || held.Borrowed > 0 || held.Interest > 0 {
+				continue
+			}
+			bid := r.GetPrice(symbol.GetBaseSymbol(), "BID", 0)
+			if bid <= 0 {
+				continue
+			}
+
+			keep := 1 - r.FeeOf(symbol.GetBaseSymbol())/100.0
+			quantity := math.Min(math.Min(recorded.(float64), held.Free), lack/(bid*keep))
+			// dust below the filters of the symbol is left alone
+			rounded := symbol.GetFilters().RoundQty(decimal.FromFloat(quantity).Truncate(symbol.GetBasePrecision()))
+			if symbol.GetFilters().Check(rounded, decimal.FromFloat(rounded.Float64()*bid)) != nil {
+				continue
+			}
+
+			result := r.repayOrder(symbol, "SELL", quantity)
+			if result == nil {
+				continue
+			}
+			sold = true
+			r.residues.Store(residual, math.Max(recorded.(float64)-result.ExecutedQty, 0))
+			lack -= result.QuoteQty * keep
+		}
+		if sold {
+			return true
+		}
+	}
+	return false
+}
+
+// repayOrder places a base sized housekeeping order and logs it as a
+// repayment entry; it is not an execution, so it stays out of the ledger.
+func (r *Robot) repayOrder(symbol market.MarketSymbol, side string, quantity float64) *market.OrderResult {
+	execution := NewExecution(r.Private.Name(), "housekeeping", "REPAY", symbol.GetQuoteAsset(), 0, 0)
+	result, err := r.Exec.order(execution, false, symbol, side, "close", quantity, symbol.GetBasePrecision())
+	if err != nil {
+		r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: %s %f %s failed: %v", side, quantity, symbol.GetBaseSymbol(), err))
+		return nil
+	}
+
+	r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Housekeeping: %s %f %s for %f %s to repay, fees %v.",
+		side, result.ExecutedQty, symbol.GetBaseAsset(), result.QuoteQty, symbol.GetQuoteAsset(), result.Fees))
+	return result
+}
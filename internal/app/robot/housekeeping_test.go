@@ -0,0 +1,99 @@
+package robot
+
+import (
+	"tarbitrage/pkg/decimal"
+	"testing"
+	"time"
+)
+
+// housekeepingRobot trades BTC+USDT, ETH+BTC and ETH+USDT on a paper account
+// which holds ETH and 5 USDT and has borrowed 0.001 BTC, so the USDT covers
+// the debt only with some ETH sold.
+func housekeepingRobot(t *testing.T) *Robot {
+	r := testRobot(t,
+		benchBook("BTC+USDT", "30000", "29990"),
+		benchBook("ETH+BTC", "0.06", "0.0599"),
+		benchBook("ETH+USDT", "1800", "1799"))
+
+	if _, err := r.Private.PlaceOrder(r.Symbols["BTC+USDT"], "SELL", "close", decimal.MustParse("0.001"), "setup-1"); err != nil {
+		t.Fatal(err)
+	}
+	balances, _ := r.Private.GetBalances()
+	if _, err := r.Private.PlaceOrder(r.Symbols["ETH+USDT"], "BUY", "open", decimal.FromFloat(balances["USDT"].Free-5), "setup-2"); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// housekeepingRecord records a failed execution of the triangle in the
+// ledger, like the detector does.
+func housekeepingRecord(t *testing.T, r *Robot, e *Execution) {
+	e.Legs = append(e.Legs, Fill{Symbol: "BTCUSDT", Side: "BUY"})
+	r.record(e)
+}
+
+func TestHousekeepKeepsOwnHoldings(t *testing.T) {
+	r := housekeepingRobot(t)
+	before, _ := r.Private.GetBalances()
+
+	r.housekeep()
+
+	balances, _ := r.Private.GetBalances()
+	if eth := balances["ETH"]; eth.Free != before["ETH"].Free {
+		t.Errorf("ETH which no execution left over is sold: %f -> %f", before["ETH"].Free, eth.Free)
+	}
+	if btc := balances["BTC"]; btc.Borrowed < 0.001 {
+		t.Errorf("BTC is bought without the USDT to buy it with, borrowed %f", btc.Borrowed)
+	}
+}
+
+func TestHousekeepSellsResidue(t *testing.T) {
+	r := housekeepingRobot(t)
+	before, _ := r.Private.GetBalances()
+	execution := NewExecution("BINANCE", "BTC+USDT->ETH+BTC->ETH+USDT", "BBS", "USDT", 100, 1.01)
+	execution.Residue = map[string]float64{"ETH": 0.05}
+	housekeepingRecord(t, r, execution)
+
+	r.housekeep()
+
+	balances, _ := r.Private.GetBalances()
+	// the quantity bought is truncated to the precision before the fee is
+	// withheld, which may leave less than a step for the next round
+	if btc := balances["BTC"]; btc.Borrowed > 1e-8 {
+		t.Errorf("%f BTC is still borrowed", btc.Borrowed)
+	}
+	// about 0.014 ETH covers the lacking 25 USDT
+	sold := before["ETH"].Free - balances["ETH"].Free
+	if sold <= 0 || sold > 0.02 {
+		t.Errorf("%f ETH is sold to cover 0.001 BTC", sold)
+	}
+	if left, _ := r.residues.Load("ETH"); left.(float64) < 0.03 {
+		t.Errorf("the recorded residue is not reduced by the amount sold: %f", left)
+	}
+
+	executions, err := r.Ledger.Read(time.Time{}, time.Time{})
+	if err != nil || len(executions) != 1 {
+		t.Errorf("housekeeping orders are recorded in the ledger: %d executions, %v", len(executions), err)
+	}
+}
+
+func TestHousekeepKeepsFeeAssets(t *testing.T) {
+	r := housekeepingRobot(t)
+	before, _ := r.Private.GetBalances()
+
+	// ETH stands for BNB here: an execution paid its fees in it
+	paid := NewExecution("BINANCE", "BTC+USDT->ETH+BTC->ETH+USDT", "BBS", "USDT", 100, 1.01)
+	paid.Fees["ETH"] = 0.0001
+	paid.Net["ETH"] = -0.0001
+	housekeepingRecord(t, r, paid)
+	left := NewExecution("BINANCE", "BTC+USDT->ETH+BTC->ETH+USDT", "BBS", "USDT", 100, 1.01)
+	left.Residue = map[string]float64{"ETH": 0.05}
+	housekeepingRecord(t, r, left)
+
+	r.housekeep()
+
+	balances, _ := r.Private.GetBalances()
+	if eth := balances["ETH"]; eth.Free != before["ETH"].Free {
+		t.Errorf("the fee asset is sold: %f -> %f", before["ETH"].Free, eth.Free)
+	}
+}
@@ -0,0 +1,137 @@
+package robot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tarbitrage/internal/app/market"
+	"time"
+)
+
+// JournalEntry is a write-ahead record of an execution: "begin" opens it,
+// "intent" is written before an order is sent, "result" after it is filled
+// and "end" once the execution is flat. "unwind_failed" marks an execution
+// left with a residue, which stays pending until it is recovered.
+type JournalEntry struct {
+	Time      time.Time           `json:"time"`
+	Execution string              `json:"execution"`
+	Event     string              `json:"event"`
+	Triangle  string              `json:"triangle,omitempty"`
+	Sequence  string              `json:"sequence,omitempty"`
+	Asset     string              `json:"asset,omitempty"`
+	Lot       float64             `json:"lot,omitempty"`
+	Expected  float64             `json:"expected_return,omitempty"`
+	Symbol    string              `json:"symbol,omitempty"`
+	Side      string              `json:"side,omitempty"`
+	Type      string              `json:"type,omitempty"`
+	Quantity  string              `json:"quantity,omitempty"`
+	ClientID  string              `json:"client_id,omitempty"`
+	Rollback  bool                `json:"rollback,omitempty"`
+	Result    *market.OrderResult `json:"result,omitempty"`
+}
+
+// Journal is an append-only JSONL file synced to disk on every entry.
+type Journal struct {
+	Path string
+	lock sync.Mutex
+}
+
+func NewJournal(path string) *Journal {
+	return &Journal{Path: path}
+}
+
+func JournalPath(market_name string) string {
+	return fmt.Sprintf("./files/%s/journal.jsonl", strings.ToLower(market_name))
+}
+
+func (j *Journal) Write(entry *JournalEntry) error {
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Pending returns the entries of every execution without an "end" entry in
+// the order the executions were begun. A truncated last line is ignored.
+func (j *Journal) Pending() ([][]*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	order := make([]string, 0)
+	executions := make(map[string][]*JournalEntry)
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := new(JournalEntry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			continue
+		}
+		switch entry.Event {
+		case "begin":
+			order = append(order, entry.Execution)
+			executions[entry.Execution] = []*JournalEntry{entry}
+		case "end":
+			delete(executions, entry.Execution)
+		default:
+			if entries, ok := executions[entry.Execution]; ok {
+				executions[entry.Execution] = append(entries, entry)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pending := make([][]*JournalEntry, 0)
+	for _, id := range order {
+		if entries, ok := executions[id]; ok {
+			pending = append(pending, entries)
+		}
+	}
+
+	return pending, nil
+}
+
+// Reset truncates the journal; settled executions are kept by the ledger.
+func (j *Journal) Reset() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	err := os.Truncate(j.Path, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,282 @@
+package robot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"tarbitrage/internal/app/market"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fill is a single order placed during a triangle execution.
+type Fill struct {
+	Symbol   string             `json:"symbol"`
+	Side     string             `json:"side"`
+	Type     string             `json:"type"`
+	OrderID  string             `json:"order_id,omitempty"`
+	Quantity float64            `json:"quantity"`
+	Quote    float64            `json:"quote"`
+	Price    float64            `json:"price"`
+	Fees     map[string]float64 `json:"fees,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// Execution is a ledger entry. Net holds the change of every asset balance
+// over the legs and rollbacks, so PnL is the net of the start asset and
+// PnLUSDT values all of them, including fees paid in third assets. Residue is
+// what an unwind failed to trade back.
+type Execution struct {
+	ID        string                    `json:"id"`
+	Time      time.Time                 `json:"time"`
+	Exchange  string                    `json:"exchange"`
+	Triangle  string                    `json:"triangle"`
+	Sequence  string                    `json:"sequence"`
+	Expected  float64                   `json:"expected_return"`
+	Lot       float64                   `json:"lot"`
+	Asset     string                    `json:"asset"`
+	Spent     float64                   `json:"spent"`
+	Received  float64                   `json:"received"`
+	PnL       float64                   `json:"pnl"`
+	PnLUSDT   float64                   `json:"pnl_usdt"`
+	Fees      map[string]float64        `json:"fees"`
+	Net       map[string]float64        `json:"net"`
+	Legs      []Fill                    `json:"legs"`
+	Rollbacks []Fill                    `json:"rollbacks,omitempty"`
+	Residue   map[string]float64        `json:"residue,omitempty"`
+	Balances  map[string]market.Balance `json:"balances,omitempty"`
+	Error     string                    `json:"error,omitempty"`
+	orders    int
+}
+
+// NewExecution starts an execution with an id usable as a client order id
+// prefix on every supported exchange.
+func NewExecution(exchange, triangle, sequence, asset string, lot, expected float64) *Execution {
+	now := time.Now()
+	return &Execution{
+		ID:        "ta" + strconv.FormatInt(now.UnixNano(), 36),
+		Time:      now,
+		Exchange:  exchange,
+		Triangle:  triangle,
+		Sequence:  sequence,
+		Expected:  expected,
+		Lot:       lot,
+		Asset:     asset,
+		Fees:      make(map[string]float64),
+		Net:       make(map[string]float64),
+		Legs:      make([]Fill, 0, 3),
+		Rollbacks: make([]Fill, 0),
+	}
+}
+
+func (e *Execution) add(list *[]Fill, symbol market.MarketSymbol, t string, result *market.OrderResult) {
+	*list = append(*list, Fill{
+		Symbol:   result.Symbol,
+		Side:     result.Side,
+		Type:     t,
+		OrderID:  result.OrderID,
+		Quantity: result.ExecutedQty,
+		Quote:    result.QuoteQty,
+		Price:    result.AvgPrice,
+		Fees:     result.Fees,
+	})
+
+	switch result.Side {
+	case "BUY":
+		e.Net[symbol.GetBaseAsset()] += result.ExecutedQty
+		e.Net[symbol.GetQuoteAsset()] -= result.QuoteQty
+	case "SELL":
+		e.Net[symbol.GetBaseAsset()] -= result.ExecutedQty
+		e.Net[symbol.GetQuoteAsset()] += result.QuoteQty
+	}
+	for asset, fee := range result.Fees {
+		e.Fees[asset] += fee
+		e.Net[asset] -= fee
+	}
+
+	if result.Side == "BUY" && symbol.GetQuoteAsset() == e.Asset {
+		e.Spent += result.Spent(symbol)
+	}
+	if result.Side == "SELL" && symbol.GetQuoteAsset() == e.Asset {
+		e.Received += result.Received(symbol)
+	}
+	e.PnL = e.Net[e.Asset]
+}
+
+// Ledger is an append-only JSONL file of executions.
+type Ledger struct {
+	Path string
+	lock sync.Mutex
+}
+
+func NewLedger(path string) *Ledger {
+	return &Ledger{Path: path}
+}
+
+func LedgerPath(market_name string) string {
+	return fmt.Sprintf("./files/%s/ledger.jsonl", strings.ToLower(market_name))
+}
+
+func (l *Ledger) Record(e *Execution) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Read returns the executions recorded within [from, to); zero bounds are open.
+// An execution recorded again, e.g. after its unwind was resumed on
+// recovery, replaces its earlier entry.
+func (l *Ledger) Read(from, to time.Time) ([]*Execution, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	executions := make([]*Execution, 0)
+	index := make(map[string]int)
+
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return executions, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e := new(Execution)
+		if err := json.Unmarshal(scanner.Bytes(), e); err != nil {
+			return nil, err
+		}
+		if !from.IsZero() && e.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !e.Time.Before(to) {
+			continue
+		}
+		if i, ok := index[e.ID]; ok {
+			executions[i] = e
+			continue
+		}
+		index[e.ID] = len(executions)
+		executions = append(executions, e)
+	}
+
+	return executions, scanner.Err()
+}
+
+// Summary is the PnL aggregated over the executions sharing a key.
+type Summary struct {
+	Key        string             `json:"key"`
+	Executions int                `json:"executions"`
+	Failed     int                `json:"failed"`
+	PnLUSDT    float64            `json:"pnl_usdt"`
+	PnL        map[string]float64 `json:"pnl"`
+	Fees       map[string]float64 `json:"fees"`
+}
+
+// Aggregate groups the executions by "day" (UTC), "triangle" or "exchange".
+func (l *Ledger) Aggregate(group string, from, to time.Time) ([]*Summary, error) {
+	var key func(e *Execution) string
+	switch group {
+	case "day", "":
+		key = func(e *Execution) string { return e.Time.UTC().Format("2006-01-02") }
+	case "triangle":
+		key = func(e *Execution) string { return e.Triangle }
+	case "exchange":
+		key = func(e *Execution) string { return e.Exchange }
+	default:
+		return nil, fmt.Errorf("unknown group: %s", group)
+	}
+
+	executions, err := l.Read(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*Summary)
+	for _, e := range executions {
+		k := key(e)
+		s, ok := groups[k]
+		if !ok {
+			s = &Summary{Key: k, PnL: make(map[string]float64), Fees: make(map[string]float64)}
+			groups[k] = s
+		}
+		s.Executions++
+		if e.Error != "" {
+			s.Failed++
+		}
+		s.PnLUSDT += e.PnLUSDT
+		s.PnL[e.Asset] += e.PnL
+		for asset, fee := range e.Fees {
+			s.Fees[asset] += fee
+		}
+	}
+
+	result := make([]*Summary, 0, len(groups))
+	for _, s := range groups {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+
+	return result, nil
+}
+
+// record values the execution in USDT and appends it to the ledger.
+func (r *Robot) record(e *Execution) {
+	if len(e.Legs) == 0 {
+		return
+	}
+
+	for asset, amount := range e.Net {
+		e.PnLUSDT += r.valueInUSDT(asset, amount)
+	}
+	r.checkBalances(e)
+	r.trackResidue(e)
+
+	r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Executed %s (%s): spent %f %s, received %f %s, PnL %.4f USDT.",
+		e.Triangle, e.Sequence, e.Spent, e.Asset, e.Received, e.Asset, e.PnLUSDT))
+
+	if err := r.Ledger.Record(e); err != nil {
+		r.logger.Log(logrus.InfoLevel, err)
+	}
+}
+
+// valueInUSDT uses the best bid of ASSET+USDT or the best ask of USDT+ASSET;
+// assets without a tracked book are not counted.
+func (r *Robot) valueInUSDT(asset string, amount float64) float64 {
+	if asset == "USDT" {
+		return amount
+	}
+	if price := r.GetPrice(asset+"+USDT", "BID", 0); price > 0 {
+		return amount * price
+	}
+	if price := r.GetPrice("USDT+"+asset, "ASK", 0); price > 0 {
+		return amount / price
+	}
+	return 0.0
+}
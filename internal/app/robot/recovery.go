@@ -0,0 +1,127 @@
+package robot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"tarbitrage/internal/app/market"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recoverExecutions settles the executions the journal has not seen finished,
+// e.g. after a crash between two legs or an unwind which left a residue: the
+// order state of every journaled intent is fetched from the exchange and
+// whatever is left of the intermediate assets is traded back to the start
+// asset. Trading must not be resumed when it fails.
+func (r *Robot) recoverExecutions() error {
+	pending, err := r.Journal.Pending()
+	if err != nil {
+		return err
+	}
+
+	if _, paper := r.Private.(*market.PaperPrivateClient); paper {
+		if len(pending) > 0 {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Discarding %d unfinished paper executions.", len(pending)))
+		}
+		return r.Journal.Reset()
+	}
+
+	for _, entries := range pending {
+		execution, err := r.recoverExecution(entries)
+		if err != nil {
+			return fmt.Errorf("unfinished execution %s has not been unwound: %v", entries[0].Execution, err)
+		}
+		r.Exec.journal(&JournalEntry{Execution: execution.ID, Event: "end"})
+		r.record(execution)
+	}
+
+	return r.Journal.Reset()
+}
+
+func (r *Robot) recoverExecution(entries []*JournalEntry) (*Execution, error) {
+	begin := entries[0]
+	execution := NewExecution(r.Private.Name(), begin.Triangle, begin.Sequence, begin.Asset, begin.Lot, begin.Expected)
+	execution.ID = begin.Execution
+	execution.Time = begin.Time
+	execution.Error = "recovered after restart"
+	for _, entry := range entries {
+		if entry.Event == "unwind_failed" {
+			execution.Error = "unwind resumed after restart"
+		}
+	}
+
+	r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Recovering unfinished execution %s of %s (%s).",
+		execution.ID, execution.Triangle, execution.Sequence))
+
+	results := make(map[string]*market.OrderResult)
+	for _, entry := range entries {
+		if entry.Event == "result" {
+			results[entry.ClientID] = entry.Result
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Event != "intent" {
+			continue
+		}
+		execution.orders++
+
+		symbol, err := r.recoverySymbol(entry.Symbol)
+		if err != nil {
+			return nil, err
+		}
+
+		result, ok := results[entry.ClientID]
+		if !ok {
+			result, err = r.Private.GetOrder(symbol, entry.ClientID)
+			if errors.Is(err, market.ErrOrderNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		list := &execution.Legs
+		if entry.Rollback {
+			list = &execution.Rollbacks
+		}
+		execution.add(list, symbol, entry.Type, result)
+	}
+
+	legs := strings.Split(begin.Triangle, "->")
+	if len(legs) != 3 {
+		return nil, fmt.Errorf("unknown triangle %s", begin.Triangle)
+	}
+	triangle := new(Triangle)
+	for i, leg := range []*market.MarketSymbol{&triangle.Initial, &triangle.Middle, &triangle.Final} {
+		symbol, err := r.recoverySymbol(legs[i])
+		if err != nil {
+			return nil, err
+		}
+		*leg = symbol
+	}
+
+	// the books are not streamed yet, so the policy takes the direct paths
+	if err := r.Exec.Unwind.Unwind(r.Exec, execution, triangle); err != nil {
+		return nil, err
+	}
+
+	return execution, nil
+}
+
+// recoverySymbol returns a traded symbol, loading the instrument info of
+// symbols which are no longer traded, e.g. after a new discovery.
+func (r *Robot) recoverySymbol(base_symbol string) (market.MarketSymbol, error) {
+	if symbol, ok := r.Symbols[base_symbol]; ok {
+		return symbol, nil
+	}
+
+	symbol := r.Public.CreateSymbol(base_symbol)
+	if err := r.Public.GetInstrumentsInfo([]market.MarketSymbol{symbol}); err != nil {
+		return nil, err
+	}
+
+	return symbol, nil
+}
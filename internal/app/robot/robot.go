@@ -8,6 +8,7 @@ import (
 	"sync"
 	"tarbitrage/internal/app/market"
 	"tarbitrage/pkg/websocket"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -23,68 +24,142 @@ func (t *Triangle) Repr() string {
 }
 
 type Robot struct {
-	Public     market.PublicClient
-	Private    market.PrivateClient
-	Symbols    map[string]market.MarketSymbol
-	Triangles  []*Triangle
-	Threashold float64
-	State      *sync.Map
-	Tickers    *sync.Map
-	Fee        float64
-	Lot        float64
-	Detectors  []*Detector
-	Exec       *Executor
-	Quit       chan struct{}
-	logger     *logrus.Logger
-}
-
-func CreateRobot(market_name, api_key, secret string, delta float64, fee float64, lot float64, logger *logrus.Logger) (*Robot, error) {
-
-	public, err := market.NewPublicClient(market_name, logger)
+	Public      market.PublicClient
+	Private     market.PrivateClient
+	Symbols     map[string]market.MarketSymbol
+	Triangles   []*Triangle
+	Threashold  float64
+	State       *sync.Map
+	Tickers     *sync.Map
+	Fee         float64
+	Lot         float64
+	Depth       string
+	Connections int
+	// Fees are the taker fees per base symbol reloaded every FeeRefresh.
+	Fees       *sync.Map
+	FeeRefresh time.Duration
+	// Balances are the margin account positions per asset reloaded after
+	// every execution.
+	Balances *sync.Map
+	// Housekeeping is the period of repaying residual margin liabilities;
+	// zero disables it.
+	Housekeeping time.Duration
+	// TimeSync is the period of measuring the exchange clock offset used
+	// to sign requests; zero measures it once on start.
+	TimeSync time.Duration
+	// StaleTimeout is the maximal period without messages on a connection,
+	// or without book updates for StaleShare of its symbols, before its
+	// books are marked stale and it is reconnected; zero disables it.
+	StaleTimeout time.Duration
+	// StaleShare is the share of the symbols of a connection which must be
+	// quiet for StaleTimeout before it is reconnected; zero means all.
+	StaleShare float64
+	// MaxBookAge and MaxBookSkew bound how old the legs of a triangle may be
+	// and how far apart their exchange times; zero disables the check.
+	MaxBookAge  time.Duration
+	MaxBookSkew time.Duration
+	Detectors   []*Detector
+	Watchers    map[string][]*Detector
+	Exec        *Executor
+	Ledger      *Ledger
+	Journal     *Journal
+	Discovery   *Discovery
+	Quit        chan struct{}
+	logger      *logrus.Logger
+	updates     *sync.Map
+	interest    *sync.Map
+	residues    *sync.Map
+	feeAssets   *sync.Map
+}
+
+func CreateRobot(market_name string, endpoints market.Endpoints, api_key, secret, passphrase string, delta float64, fee float64, lot float64,
+	paper bool, paper_balance float64, logger *logrus.Logger) (*Robot, error) {
+
+	public, err := market.NewPublicClient(market_name, endpoints, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	private, _ := market.NewPrivateClient(market_name, api_key, secret)
-	executor := Executor{
-		Client:  private,
+	bot := &Robot{
+		Public:       public,
+		Threashold:   delta,
+		Quit:         make(chan struct{}),
+		Symbols:      make(map[string]market.MarketSymbol),
+		Triangles:    make([]*Triangle, 0),
+		Tickers:      new(sync.Map),
+		State:        new(sync.Map),
+		Fees:         new(sync.Map),
+		Housekeeping: 10 * time.Minute,
+		TimeSync:     10 * time.Minute,
+		Balances:     new(sync.Map),
+		interest:     new(sync.Map),
+		residues:     new(sync.Map),
+		feeAssets:    new(sync.Map),
+		FeeRefresh:   time.Hour,
+		Detectors:    make([]*Detector, 0),
+		Watchers:     make(map[string][]*Detector),
+		Fee:          fee,
+		Lot:          lot,
+		Depth:        "5",
+		Connections:  1,
+		logger:       logger,
+		updates:      new(sync.Map),
+	}
+
+	if paper {
+		private, err := market.NewPaperPrivateClient(market_name, api_key, secret, paper_balance, logger)
+		if err != nil {
+			return nil, err
+		}
+		private.State = bot.State
+		private.Fee = &bot.Fee
+		bot.Private = private
+	} else {
+		private, err := market.NewPrivateClient(market_name, endpoints, api_key, secret, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		bot.Private = private
+	}
+
+	bot.Exec = &Executor{
+		Client:  bot.Private,
 		Lock:    sync.Mutex{},
 		Counter: 0,
 	}
+	bot.Exec.Unwind, _ = NewUnwindPolicy("", bot)
+	bot.Exec.Books = bot.GetBook
 
-	return &Robot{
-		Public:     public,
-		Private:    private,
-		Threashold: delta,
-		Quit:       make(chan struct{}),
-		Symbols:    make(map[string]market.MarketSymbol),
-		Triangles:  make([]*Triangle, 0),
-		Tickers:    new(sync.Map),
-		State:      new(sync.Map),
-		Detectors:  make([]*Detector, 0),
-		Exec:       &executor,
-		Fee:        fee,
-		Lot:        lot,
-		logger:     logger,
-	}, nil
+	return bot, nil
 }
 
 func (r *Robot) Start() error {
-	if err := r.readSymbols(); err != nil {
-		return err
-	}
-	if err := r.readTriangles(); err != nil {
-		return err
+	if r.Discovery != nil {
+		if err := r.discoverTriangles(); err != nil {
+			return err
+		}
+	} else {
+		if err := r.readSymbols(); err != nil {
+			return err
+		}
+		if err := r.readTriangles(); err != nil {
+			return err
+		}
 	}
 
-	r.Exec.Fee = &r.Fee
+	if len(r.Triangles) == 0 {
+		return fmt.Errorf("no triangles to trade on %s", r.Public.Name())
+	}
 
-	// pricePrecision, basePrecision, err := r.Public.GetInstrumentInfo("SANDUSDT")
-	// if err != nil {
-	// 	return err
-	// }
+	if r.Ledger == nil {
+		r.Ledger = NewLedger(LedgerPath(r.Public.Name()))
+	}
+	if r.Journal == nil {
+		r.Journal = NewJournal(JournalPath(r.Public.Name()))
+	}
+	r.Exec.Journal = r.Journal
 
-	// fmt.Println(pricePrecision, basePrecision)
+	r.SyncTime()
 
 	request := make([]market.MarketSymbol, 0)
 
@@ -96,76 +171,111 @@ func (r *Robot) Start() error {
 		return err
 	}
 
-	fmt.Println(r.Symbols["DOT+BTC"])
+	r.LoadFees()
+	if err := r.LoadBalances(); err != nil {
+		return err
+	}
+
+	if err := r.recoverExecutions(); err != nil {
+		return err
+	}
 
 	if err := r.Private.ApplyInitial(r.Lot); err != nil {
 		return err
 	}
 
-	r.RunTickers()
 	r.RunDetectors()
+	if err := r.RunTickers(); err != nil {
+		r.StopDetectors()
+		return err
+	}
+	r.RunWatchdog()
+	r.RunFees()
+	r.RunHousekeeping()
+	r.RunTimeSync()
 
 	return nil
 }
 
-func (r *Robot) RunOrderBookStream(symbol market.MarketSymbol) error {
+func (r *Robot) RunTickers() error {
 
 	depthHandler := func(event *market.OrderBookEvent) {
-		r.State.Store(symbol.GetBaseSymbol(), event)
+		r.State.Store(event.Symbol, event)
+		r.updates.Store(event.Symbol, time.Now())
+		r.notify(event.Symbol)
 	}
 
 	errHandler := func(err error) {
 		r.logger.Log(logrus.InfoLevel, err)
 	}
 
-	stream, err := r.Public.RunOrderBookStream(symbol, "5", depthHandler, errHandler)
+	symbols := make([]market.MarketSymbol, 0, len(r.Symbols))
+	for _, symbol := range r.Symbols {
+		symbols = append(symbols, symbol)
+	}
+
+	streams, err := r.Public.RunOrderBookStreams(symbols, r.Depth, r.Connections, depthHandler, errHandler)
 	if err != nil {
 		return err
 	}
 
-	r.Tickers.Store(symbol.GetBaseSymbol(), stream)
-
-	return nil
-}
-
-func (r *Robot) RunTickers() error {
-
-	wg := new(sync.WaitGroup)
-
-	for _, symbol := range r.Symbols {
-		wg.Add(1)
-		go func(wg *sync.WaitGroup) {
-			defer wg.Done()
-			r.RunOrderBookStream(symbol)
-		}(wg)
+	for base_symbol, stream := range streams {
+		r.Tickers.Store(base_symbol, stream)
 	}
 
-	wg.Wait()
-
 	return nil
 }
 
+// StopTickers closes every connection once, as several symbols share one.
 func (r *Robot) StopTickers() {
-	for _, symbol := range r.Symbols {
-		ws, ok := r.Tickers.Load(symbol.GetBaseSymbol())
-		if ok {
-			ws.(*websocket.WebSocketApp).Close()
+	closed := make(map[*websocket.WebSocketApp]bool)
+	r.Tickers.Range(func(key, value interface{}) bool {
+		ws := value.(*websocket.WebSocketApp)
+		if !closed[ws] {
+			closed[ws] = true
+			ws.Close()
 		}
-	}
+		r.Tickers.Delete(key)
+		return true
+	})
 }
 
+// RunDetectors registers a detector for every triangle under each of its
+// symbols, so that an order book update wakes only the affected detectors.
+// It must be called before the order book streams are started.
 func (r *Robot) RunDetectors() {
 	for _, triangle := range r.Triangles {
 		d := new(Detector)
 		d.Triangle = triangle
 		d.Quit = make(chan struct{})
-		d.Fee = r.Fee
+		d.Notify = make(chan struct{}, 1)
 		d.Robot = r
+		for _, symbol := range []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final} {
+			r.Watchers[symbol.GetBaseSymbol()] = append(r.Watchers[symbol.GetBaseSymbol()], d)
+		}
 		d.Run()
 		r.Detectors = append(r.Detectors, d)
 	}
 }
 
+func (r *Robot) notify(base_symbol string) {
+	for _, d := range r.Watchers[base_symbol] {
+		select {
+		case d.Notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SkippedEvaluations is the number of detections skipped on outdated books.
+func (r *Robot) SkippedEvaluations() uint64 {
+	total := uint64(0)
+	for _, detector := range r.Detectors {
+		total += detector.Skipped.Load()
+	}
+	return total
+}
+
 func (r *Robot) StopDetectors() {
 	for _, detector := range r.Detectors {
 		detector.Stop()
@@ -173,6 +283,7 @@ func (r *Robot) StopDetectors() {
 }
 
 func (r *Robot) Stop() {
+	close(r.Quit)
 	r.StopDetectors()
 	r.StopTickers()
 }
@@ -223,21 +334,34 @@ func (r *Robot) readTriangles() error {
 	return nil
 }
 
-func (r *Robot) GetPrice(symbol, side string, number int) float64 {
-
+func (r *Robot) GetBook(symbol string) (*market.OrderBookEvent, bool) {
 	order_book, _ := r.State.Load(symbol)
 	if order_book == nil {
-		return 0.0
+		return nil, false
 	}
-	if len(order_book.(*market.OrderBookEvent).Asks) == 0 {
+	book := order_book.(*market.OrderBookEvent)
+	if book.Stale || len(book.Asks) == 0 || len(book.Bids) == 0 {
+		return nil, false
+	}
+	return book, true
+}
+
+func (r *Robot) GetPrice(symbol, side string, number int) float64 {
+
+	book, ok := r.GetBook(symbol)
+	if !ok {
 		return 0.0
 	}
 
 	switch side {
 	case "ASK":
-		return order_book.(*market.OrderBookEvent).Asks[number].Price
+		if number < len(book.Asks) {
+			return book.Asks[number].Price.Float64()
+		}
 	case "BID":
-		return order_book.(*market.OrderBookEvent).Bids[number].Price
+		if number < len(book.Bids) {
+			return book.Bids[number].Price.Float64()
+		}
 	}
 
 	return 0.0
@@ -0,0 +1,78 @@
+package robot
+
+import (
+	"io"
+	"path/filepath"
+	"sync"
+	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/decimal"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func benchBook(symbol string, ask, bid string) *market.OrderBookEvent {
+	now := time.Now()
+	return &market.OrderBookEvent{
+		Symbol:      symbol,
+		Asks:        []market.PriceLevel{{Price: decimal.MustParse(ask), Quantity: decimal.MustParse("1000")}},
+		Bids:        []market.PriceLevel{{Price: decimal.MustParse(bid), Quantity: decimal.MustParse("1000")}},
+		EventTime:   now,
+		ReceiveTime: now,
+	}
+}
+
+// testRobot returns a robot trading the symbols of the books on a paper
+// BINANCE account of 1000 USDT, filled from the books with a fee of 0.1%.
+// The ledger and the journal are kept in a temporary directory and failed
+// executions are unwound in reverse; tests change what they need.
+func testRobot(tb testing.TB, books ...*market.OrderBookEvent) *Robot {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	state := new(sync.Map)
+	public := new(market.BinancePublicClient)
+	symbols := make(map[string]market.MarketSymbol)
+	for _, book := range books {
+		state.Store(book.Symbol, book)
+		symbol := public.CreateSymbol(book.Symbol)
+		symbol.SetBasePrecision(8)
+		symbol.SetPricePrecision(8)
+		symbols[book.Symbol] = symbol
+	}
+
+	fee := 0.1
+	private, err := market.NewPaperPrivateClient("BINANCE", "", "", 1000, logger)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	private.State = state
+	private.Fee = &fee
+
+	r := &Robot{
+		Private:    private,
+		Symbols:    symbols,
+		Threashold: 0.005,
+		Lot:        100,
+		Fee:        fee,
+		State:      state,
+		Tickers:    new(sync.Map),
+		Fees:       new(sync.Map),
+		Balances:   new(sync.Map),
+		Watchers:   make(map[string][]*Detector),
+		Ledger:     NewLedger(filepath.Join(tb.TempDir(), "ledger.jsonl")),
+		Journal:    NewJournal(filepath.Join(tb.TempDir(), "journal.jsonl")),
+		logger:     logger,
+		updates:    new(sync.Map),
+		interest:   new(sync.Map),
+		residues:   new(sync.Map),
+		feeAssets:  new(sync.Map),
+	}
+	r.Exec = &Executor{
+		Client:  private,
+		Journal: r.Journal,
+		Unwind:  &ReverseUnwind{Robot: r},
+	}
+	return r
+}
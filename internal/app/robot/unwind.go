@@ -0,0 +1,299 @@
+package robot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/decimal"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// UnwindPolicy trades the intermediate assets an interrupted execution holds
+// or owes back to its start asset. The orders are placed as rollbacks of the
+// execution; whatever cannot be traded back is reported in its Residue.
+type UnwindPolicy interface {
+	Unwind(ex *Executor, execution *Execution, triangle *Triangle) error
+}
+
+func NewUnwindPolicy(name string, r *Robot) (UnwindPolicy, error) {
+	switch name {
+	case "cheapest", "":
+		return &CheapestUnwind{Robot: r, Retries: 3, Backoff: time.Second}, nil
+	case "reverse":
+		return &ReverseUnwind{Robot: r, Retries: 3, Backoff: time.Second}, nil
+	}
+	return nil, fmt.Errorf("unknown unwind policy: %s", name)
+}
+
+// ReverseUnwind trades every asset straight back to the start asset, which
+// reverses the filled legs.
+type ReverseUnwind struct {
+	Robot   *Robot
+	Retries int
+	Backoff time.Duration
+}
+
+func (u *ReverseUnwind) Unwind(ex *Executor, execution *Execution, triangle *Triangle) error {
+	return unwind(u.Robot, ex, execution, triangle, u.Retries, u.Backoff, false)
+}
+
+// CheapestUnwind simulates every path back to the start asset over the live
+// books, so completing the triangle is preferred when it costs less than
+// reversing it. Without books it falls back to the direct path.
+type CheapestUnwind struct {
+	Robot   *Robot
+	Retries int
+	Backoff time.Duration
+}
+
+func (u *CheapestUnwind) Unwind(ex *Executor, execution *Execution, triangle *Triangle) error {
+	return unwind(u.Robot, ex, execution, triangle, u.Retries, u.Backoff, true)
+}
+
+// unwindStep converts the asset from into the asset to over the symbol.
+type unwindStep struct {
+	symbol   market.MarketSymbol
+	from, to string
+}
+
+// unwindPath is a sequence of steps with the quantities to order, each in the
+// asset the step acquires for a debt or spends for a holding.
+type unwindPath struct {
+	steps      []unwindStep
+	quantities []float64
+	value      float64
+}
+
+// paths enumerates the simple paths between two assets over the symbols of
+// the triangle, shortest first.
+func paths(triangle *Triangle, from, to string) [][]unwindStep {
+	symbols := []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final}
+	result := make([][]unwindStep, 0)
+
+	var walk func(asset string, visited map[string]bool, steps []unwindStep)
+	walk = func(asset string, visited map[string]bool, steps []unwindStep) {
+		if asset == to {
+			result = append(result, append([]unwindStep(nil), steps...))
+			return
+		}
+		for _, symbol := range symbols {
+			next := ""
+			switch asset {
+			case symbol.GetBaseAsset():
+				next = symbol.GetQuoteAsset()
+			case symbol.GetQuoteAsset():
+				next = symbol.GetBaseAsset()
+			default:
+				continue
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			walk(next, visited, append(steps, unwindStep{symbol: symbol, from: asset, to: next}))
+			visited[next] = false
+		}
+	}
+	walk(from, map[string]bool{from: true}, nil)
+
+	for i := 1; i < len(result); i++ {
+		for j := i; j > 0 && len(result[j]) < len(result[j-1]); j-- {
+			result[j], result[j-1] = result[j-1], result[j]
+		}
+	}
+
+	return result
+}
+
+// sell simulates trading amount of the held asset along the steps and returns
+// the amount of the start asset received.
+func (r *Robot) sell(steps []unwindStep, amount float64) (*unwindPath, bool) {
+	path := &unwindPath{steps: steps}
+
+	for _, step := range steps {
+		keep := 1 - r.FeeOf(step.symbol.GetBaseSymbol())/100.0
+		path.quantities = append(path.quantities, amount)
+		book, ok := r.GetBook(step.symbol.GetBaseSymbol())
+		if !ok {
+			return path, false
+		}
+		if step.from == step.symbol.GetBaseAsset() {
+			_, quote, ok := market.FillBase(book.Bids, amount)
+			if !ok {
+				return path, false
+			}
+			amount = quote * keep
+		} else {
+			base, _, ok := market.FillQuote(book.Asks, amount)
+			if !ok {
+				return path, false
+			}
+			amount = base * keep
+		}
+	}
+
+	path.value = amount
+	return path, true
+}
+
+// buy simulates acquiring amount of the owed asset along the steps, walking
+// them backwards, and returns the amount of the start asset spent.
+func (r *Robot) buy(steps []unwindStep, amount float64) (*unwindPath, bool) {
+	path := &unwindPath{steps: steps, quantities: make([]float64, len(steps))}
+
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		keep := 1 - r.FeeOf(step.symbol.GetBaseSymbol())/100.0
+		path.quantities[i] = amount / keep
+		book, ok := r.GetBook(step.symbol.GetBaseSymbol())
+		if !ok {
+			return path, false
+		}
+		if step.to == step.symbol.GetBaseAsset() {
+			_, quote, ok := market.FillBase(book.Asks, amount/keep)
+			if !ok {
+				return path, false
+			}
+			amount = quote
+		} else {
+			base, _, ok := market.FillQuote(book.Bids, amount/keep)
+			if !ok {
+				return path, false
+			}
+			amount = base
+		}
+	}
+
+	path.value = amount
+	return path, true
+}
+
+// choose returns the path to unwind amount of the asset (negative for a debt).
+func (r *Robot) choose(triangle *Triangle, asset, start string, amount float64, cheapest bool) (*unwindPath, error) {
+	// a holding is sold for the start asset, a debt is bought back with it
+	from, to, route := asset, start, fmt.Sprintf("sell %s for %s", asset, start)
+	if amount < 0 {
+		from, to, route = start, asset, fmt.Sprintf("buy back %s with %s", asset, start)
+	}
+	candidates := paths(triangle, from, to)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no path to %s", route)
+	}
+
+	simulate := func(steps []unwindStep) (*unwindPath, bool) {
+		if amount > 0 {
+			return r.sell(steps, amount)
+		}
+		return r.buy(steps, -amount)
+	}
+
+	var best *unwindPath
+	if cheapest {
+		for _, steps := range candidates {
+			path, ok := simulate(steps)
+			if !ok {
+				continue
+			}
+			if best == nil || (amount > 0 && path.value > best.value) || (amount < 0 && path.value < best.value) {
+				best = path
+			}
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+
+	// the direct path is sized by the amount alone, the books are not needed
+	direct := candidates[0]
+	if len(direct) != 1 {
+		return nil, fmt.Errorf("no direct path to %s", route)
+	}
+	best, _ = simulate(direct)
+	return best, nil
+}
+
+func (ex *Executor) follow(execution *Execution, path *unwindPath, debt bool) error {
+	amount := path.quantities[0]
+	for i, step := range path.steps {
+		symbol := step.symbol
+		if debt {
+			amount = path.quantities[i]
+		}
+
+		var result *market.OrderResult
+		var err error
+		switch {
+		case !debt && step.from == symbol.GetBaseAsset():
+			result, err = ex.order(execution, true, symbol, "SELL", "close", amount, symbol.GetBasePrecision())
+		case !debt:
+			result, err = ex.order(execution, true, symbol, "BUY", "open", amount, symbol.GetPricePrecision())
+		case step.to == symbol.GetBaseAsset():
+			result, err = ex.order(execution, true, symbol, "BUY", "close", amount, symbol.GetBasePrecision())
+		default:
+			result, err = ex.order(execution, true, symbol, "SELL", "open", amount, symbol.GetPricePrecision())
+		}
+		if err != nil {
+			return err
+		}
+		amount = result.Received(symbol)
+	}
+	return nil
+}
+
+// residue returns the intermediate assets of the execution which are still
+// held or owed and large enough to be traded.
+func residue(execution *Execution, triangle *Triangle) map[string]float64 {
+	result := make(map[string]float64)
+	for _, symbol := range []market.MarketSymbol{triangle.Initial, triangle.Middle, triangle.Final} {
+		asset := symbol.GetBaseAsset()
+		if asset == execution.Asset {
+			continue
+		}
+		amount := execution.Net[asset]
+		if !decimal.FromFloat(math.Abs(amount)).Truncate(symbol.GetBasePrecision()).FloorToStep(symbol.GetFilters().StepSize).IsZero() {
+			result[asset] = amount
+		}
+	}
+	return result
+}
+
+func unwind(r *Robot, ex *Executor, execution *Execution, triangle *Triangle, retries int, backoff time.Duration, cheapest bool) error {
+	for attempt := 1; ; attempt++ {
+		left := residue(execution, triangle)
+		if len(left) == 0 {
+			execution.Residue = nil
+			return nil
+		}
+		if attempt > retries+1 {
+			execution.Residue = left
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Unwind of execution %s gave up with residue %v.", execution.ID, left))
+			return fmt.Errorf("unwind of execution %s left residue %v", execution.ID, left)
+		}
+		if attempt > 1 {
+			time.Sleep(backoff << (attempt - 2))
+		}
+
+		for asset, amount := range left {
+			path, err := r.choose(triangle, asset, execution.Asset, amount, cheapest)
+			if err != nil {
+				r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Unwind of execution %s, attempt %d: %v.", execution.ID, attempt, err))
+				break
+			}
+
+			route := make([]string, 0, len(path.steps))
+			for _, step := range path.steps {
+				route = append(route, step.symbol.GetBaseSymbol())
+			}
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Unwind of execution %s, attempt %d: %f %s over %s.",
+				execution.ID, attempt, amount, asset, strings.Join(route, "->")))
+
+			if err := ex.follow(execution, path, amount < 0); err != nil {
+				r.logger.Log(logrus.InfoLevel, fmt.Sprintf("Unwind of execution %s, attempt %d failed: %v.", execution.ID, attempt, err))
+				break
+			}
+		}
+	}
+}
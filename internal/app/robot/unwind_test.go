@@ -0,0 +1,26 @@
+package robot
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChooseNoPath(t *testing.T) {
+	r := executorRobot(t)
+	triangle := executorTriangle()
+
+	tests := []struct {
+		amount float64
+		want   string
+	}{
+		{1, "no path to sell LTC for USDT"},
+		{-1, "no path to buy back LTC with USDT"},
+	}
+
+	for _, tt := range tests {
+		_, err := r.choose(triangle, "LTC", "USDT", tt.amount, true)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("choose(LTC, %v) = %v, want %q", tt.amount, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package robot
+
+import (
+	"fmt"
+	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/websocket"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RunWatchdog reconnects a connection when it has received nothing, not even
+// a heartbeat, for StaleTimeout, or when StaleShare of its symbols have had no
+// book updates for that long. The books carried by the connection are marked
+// stale until it has resubscribed. A quiet symbol on a live connection keeps
+// its book, as streams pushing on change send nothing for an unchanged one.
+func (r *Robot) RunWatchdog() {
+	if r.StaleTimeout <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for base_symbol := range r.Symbols {
+		r.updates.Store(base_symbol, now)
+	}
+
+	interval := r.StaleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Quit:
+				return
+			case <-ticker.C:
+				r.checkStale()
+			}
+		}
+	}()
+}
+
+func (r *Robot) checkStale() {
+	symbols := make(map[*websocket.WebSocketApp][]string)
+	quiet := make(map[*websocket.WebSocketApp][]string)
+
+	r.Tickers.Range(func(key, value interface{}) bool {
+		base_symbol, conn := key.(string), value.(*websocket.WebSocketApp)
+		symbols[conn] = append(symbols[conn], base_symbol)
+		if last, ok := r.updates.Load(base_symbol); ok && time.Since(last.(time.Time)) >= r.StaleTimeout {
+			quiet[conn] = append(quiet[conn], base_symbol)
+		}
+		return true
+	})
+
+	share := r.StaleShare
+	if share <= 0 || share > 1 {
+		share = 1
+	}
+
+	for conn, all := range symbols {
+		silent := time.Since(conn.LastMessage()) >= r.StaleTimeout
+		if !silent && float64(len(quiet[conn])) < share*float64(len(all)) {
+			continue
+		}
+
+		if silent {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("No messages for %d symbols during %s, reconnecting.", len(all), r.StaleTimeout))
+		} else {
+			r.logger.Log(logrus.InfoLevel, fmt.Sprintf("No order book updates for %d of %d symbols %v during %s, reconnecting.",
+				len(quiet[conn]), len(all), quiet[conn], r.StaleTimeout))
+		}
+
+		// give every symbol of the connection time to resubscribe
+		now := time.Now()
+		for _, base_symbol := range all {
+			r.markStale(base_symbol)
+			r.updates.Store(base_symbol, now)
+		}
+
+		conn.ForceReconnect()
+	}
+}
+
+func (r *Robot) markStale(base_symbol string) {
+	order_book, _ := r.State.Load(base_symbol)
+	if order_book == nil {
+		return
+	}
+
+	book := order_book.(*market.OrderBookEvent)
+	if book.Stale {
+		return
+	}
+
+	stale := *book
+	stale.Stale = true
+	r.State.CompareAndSwap(base_symbol, book, &stale)
+}
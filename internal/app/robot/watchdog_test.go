@@ -0,0 +1,163 @@
+package robot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tarbitrage/internal/app/market"
+	"tarbitrage/pkg/websocket"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+)
+
+// watchdogStream connects to a local server which sends nothing and reports
+// every reconnection.
+func watchdogStream(t *testing.T) (*websocket.WebSocketApp, chan struct{}) {
+	upgrader := gorilla.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	connected := make(chan struct{}, 8)
+	reconnects := make(chan struct{}, 8)
+	ws := &websocket.WebSocketApp{
+		OnStateChange: func(ws *websocket.WebSocketApp, state websocket.ConnectionState) {
+			switch state {
+			case websocket.StateConnected:
+				connected <- struct{}{}
+			case websocket.StateReconnecting:
+				reconnects <- struct{}{}
+			}
+		},
+	}
+	if err := ws.Run("ws"+strings.TrimPrefix(srv.URL, "http"), false, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ws.Close)
+
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not connected")
+	}
+
+	return ws, reconnects
+}
+
+// watchdogRobot carries the books of the symbols over the connection.
+func watchdogRobot(t *testing.T, ws *websocket.WebSocketApp, symbols ...string) *Robot {
+	books := make([]*market.OrderBookEvent, 0, len(symbols))
+	for _, base_symbol := range symbols {
+		books = append(books, &market.OrderBookEvent{Symbol: base_symbol})
+	}
+	r := testRobot(t, books...)
+	r.StaleTimeout = time.Minute
+
+	now := time.Now()
+	for _, base_symbol := range symbols {
+		r.Tickers.Store(base_symbol, ws)
+		r.updates.Store(base_symbol, now)
+	}
+	return r
+}
+
+func reconnected(reconnects chan struct{}) bool {
+	select {
+	case <-reconnects:
+		return true
+	case <-time.After(300 * time.Millisecond):
+		return false
+	}
+}
+
+func isStale(r *Robot, base_symbol string) bool {
+	book, _ := r.State.Load(base_symbol)
+	return book.(*market.OrderBookEvent).Stale
+}
+
+func TestCheckStaleQuietSymbol(t *testing.T) {
+	ws, reconnects := watchdogStream(t)
+	r := watchdogRobot(t, ws, "ETH+BTC", "BTC+USDT", "ETH+USDT")
+
+	// an illiquid pair on a live connection
+	r.updates.Store("ETH+BTC", time.Now().Add(-2*r.StaleTimeout))
+	r.checkStale()
+
+	if reconnected(reconnects) {
+		t.Error("a single quiet symbol reconnected the connection")
+	}
+	if isStale(r, "ETH+BTC") {
+		t.Error("the book of a quiet symbol on a live connection is marked stale")
+	}
+}
+
+func TestCheckStaleShare(t *testing.T) {
+	ws, reconnects := watchdogStream(t)
+	r := watchdogRobot(t, ws, "ETH+BTC", "BTC+USDT", "ETH+USDT", "LTC+BTC")
+	r.StaleShare = 0.5
+
+	r.updates.Store("ETH+BTC", time.Now().Add(-2*r.StaleTimeout))
+	r.checkStale()
+	if reconnected(reconnects) {
+		t.Fatal("1 of 4 quiet symbols reconnected at a share of 50%")
+	}
+
+	r.updates.Store("LTC+BTC", time.Now().Add(-2*r.StaleTimeout))
+	r.checkStale()
+	if !reconnected(reconnects) {
+		t.Fatal("2 of 4 quiet symbols did not reconnect at a share of 50%")
+	}
+	for _, base_symbol := range []string{"ETH+BTC", "BTC+USDT", "ETH+USDT", "LTC+BTC"} {
+		if !isStale(r, base_symbol) {
+			t.Errorf("%s is not marked stale while resubscribing", base_symbol)
+		}
+		last, _ := r.updates.Load(base_symbol)
+		if time.Since(last.(time.Time)) > time.Second {
+			t.Errorf("%s has no time to resubscribe", base_symbol)
+		}
+	}
+}
+
+func TestCheckStaleAllQuiet(t *testing.T) {
+	ws, reconnects := watchdogStream(t)
+	r := watchdogRobot(t, ws, "ETH+BTC", "BTC+USDT")
+
+	for _, base_symbol := range []string{"ETH+BTC", "BTC+USDT"} {
+		r.updates.Store(base_symbol, time.Now().Add(-2*r.StaleTimeout))
+	}
+	r.checkStale()
+
+	if !reconnected(reconnects) {
+		t.Error("a connection with every symbol quiet was not reconnected")
+	}
+}
+
+func TestCheckStaleSilentConnection(t *testing.T) {
+	ws, reconnects := watchdogStream(t)
+	r := watchdogRobot(t, ws, "ETH+BTC", "BTC+USDT")
+	r.StaleTimeout = 200 * time.Millisecond
+
+	// the books are recent, but nothing has arrived on the connection
+	time.Sleep(r.StaleTimeout)
+	now := time.Now()
+	for _, base_symbol := range []string{"ETH+BTC", "BTC+USDT"} {
+		r.updates.Store(base_symbol, now)
+	}
+	r.checkStale()
+
+	if !reconnected(reconnects) {
+		t.Error("a silent connection was not reconnected")
+	}
+}
@@ -0,0 +1,373 @@
+// Package decimal implements fixed-point numbers for prices and quantities:
+// an int64 coefficient scaled by a power of ten. Exchange strings are parsed
+// exactly and rounding is always explicit.
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// MaxScale is the maximal number of digits after the decimal point; longer
+// fractions are truncated.
+const MaxScale = 18
+
+var pow10 = [MaxScale + 1]int64{
+	1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9,
+	1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18,
+}
+
+// Decimal is coef * 10^-scale. The zero value is 0.
+type Decimal struct {
+	coef  int64
+	scale int32
+}
+
+var Zero = Decimal{}
+
+// Max and Min are the values results saturate to when they do not fit.
+var (
+	Max = Decimal{coef: math.MaxInt64}
+	Min = Decimal{coef: math.MinInt64}
+)
+
+// ErrOverflow is returned when the integer part of a result does not fit.
+var ErrOverflow = errors.New("decimal: overflow")
+
+// maxExponent bounds the exponent accepted by Parse.
+const maxExponent = 64
+
+// New is coef * 10^-scale, saturated to Max or Min when it does not fit.
+func New(coef int64, scale int32) Decimal {
+	if scale < 0 {
+		return saturate(new(big.Int).Mul(big.NewInt(coef), bigPow10(-scale)), 0)
+	}
+	return saturate(big.NewInt(coef), scale)
+}
+
+// Parse reads a decimal string such as "-12.340" or, in exponent notation,
+// "1e-8".
+func Parse(s string) (Decimal, error) {
+	str := s
+	negative := false
+	switch {
+	case strings.HasPrefix(str, "-"):
+		negative = true
+		str = str[1:]
+	case strings.HasPrefix(str, "+"):
+		str = str[1:]
+	}
+
+	exponent := 0
+	if e := strings.IndexAny(str, "eE"); e >= 0 {
+		exp, err := strconv.Atoi(str[e+1:])
+		if err != nil {
+			return Zero, fmt.Errorf("decimal: invalid number %q", s)
+		}
+		if exp > maxExponent || exp < -maxExponent {
+			return Zero, fmt.Errorf("decimal: %q is out of range", s)
+		}
+		str, exponent = str[:e], exp
+	}
+
+	integer, fraction := str, ""
+	if dot := strings.IndexByte(str, '.'); dot >= 0 {
+		integer, fraction = str[:dot], str[dot+1:]
+	}
+	if integer == "" && fraction == "" {
+		return Zero, fmt.Errorf("decimal: invalid number %q", s)
+	}
+	for _, c := range integer + fraction {
+		if c < '0' || c > '9' {
+			return Zero, fmt.Errorf("decimal: invalid number %q", s)
+		}
+	}
+	if exponent != 0 {
+		integer, fraction = shift(integer, fraction, exponent)
+	}
+	if len(fraction) > MaxScale {
+		fraction = fraction[:MaxScale]
+	}
+
+	// drop fraction digits until the coefficient fits into int64
+	for {
+		digits := strings.TrimLeft(integer+fraction, "0")
+		if digits == "" {
+			return Decimal{scale: int32(len(fraction))}, nil
+		}
+		coef, err := strconv.ParseInt(digits, 10, 64)
+		if err == nil {
+			if negative {
+				coef = -coef
+			}
+			return Decimal{coef: coef, scale: int32(len(fraction))}, nil
+		}
+		if len(fraction) == 0 {
+			return Zero, fmt.Errorf("decimal: %q is out of range", s)
+		}
+		fraction = fraction[:len(fraction)-1]
+	}
+}
+
+// shift moves the decimal point of integer.fraction by exponent places.
+func shift(integer, fraction string, exponent int) (string, string) {
+	digits := integer + fraction
+	point := len(integer) + exponent
+	switch {
+	case point <= 0:
+		return "", strings.Repeat("0", -point) + digits
+	case point >= len(digits):
+		return digits + strings.Repeat("0", point-len(digits)), ""
+	}
+	return digits[:point], digits[point:]
+}
+
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// FromFloat converts the shortest representation of f; NaN is Zero and values
+// out of range saturate to Max or Min.
+func FromFloat(f float64) Decimal {
+	if math.IsNaN(f) {
+		return Zero
+	}
+	d, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		if f > 0 {
+			return Max
+		}
+		return Min
+	}
+	return d
+}
+
+func (d Decimal) Float64() float64 {
+	if d.scale == 0 {
+		return float64(d.coef)
+	}
+	return float64(d.coef) / float64(pow10[d.scale])
+}
+
+func (d Decimal) String() string {
+	digits := strconv.FormatUint(abs(d.coef), 10)
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if d.coef < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Scale is the number of significant digits after the decimal point, e.g. 8
+// for "0.00000001", 2 for "0.0100" and 0 for "10".
+func (d Decimal) Scale() int {
+	coef, scale := d.coef, d.scale
+	for scale > 0 && coef%10 == 0 {
+		coef /= 10
+		scale--
+	}
+	return int(scale)
+}
+
+func (d Decimal) IsZero() bool {
+	return d.coef == 0
+}
+
+func (d Decimal) Sign() int {
+	switch {
+	case d.coef > 0:
+		return 1
+	case d.coef < 0:
+		return -1
+	}
+	return 0
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: -d.coef, scale: d.scale}
+}
+
+// Cmp returns -1, 0 or 1 as d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	if d.scale == o.scale {
+		switch {
+		case d.coef < o.coef:
+			return -1
+		case d.coef > o.coef:
+			return 1
+		}
+		return 0
+	}
+	if a, b, _, ok := align(d, o); ok {
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	}
+	a, b, _ := alignBig(d, o)
+	return a.Cmp(b)
+}
+
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+// Add returns ErrOverflow when the integer part of the sum does not fit.
+func (d Decimal) Add(o Decimal) (Decimal, error) {
+	a, b, scale := alignBig(d, o)
+	return fromBig(a.Add(a, b), scale)
+}
+
+// Sub returns ErrOverflow when the integer part of the difference does not
+// fit.
+func (d Decimal) Sub(o Decimal) (Decimal, error) {
+	a, b, scale := alignBig(d, o)
+	return fromBig(a.Sub(a, b), scale)
+}
+
+// Mul is exact up to MaxScale digits after the point; further digits are
+// truncated. It returns ErrOverflow when the integer part does not fit.
+func (d Decimal) Mul(o Decimal) (Decimal, error) {
+	v := new(big.Int).Mul(big.NewInt(d.coef), big.NewInt(o.coef))
+	return fromBig(v, d.scale+o.scale)
+}
+
+// Truncate drops the digits after the given number of decimal places,
+// rounding toward zero.
+func (d Decimal) Truncate(places int) Decimal {
+	if places < 0 {
+		places = 0
+	}
+	if int(d.scale) <= places {
+		return d
+	}
+	return Decimal{coef: d.coef / pow10[int(d.scale)-places], scale: int32(places)}
+}
+
+// FloorToStep rounds d down to a multiple of step, e.g. a tick size of
+// "0.00000001" or a lot size of "10". A non-positive step leaves d unchanged;
+// the result saturates to Min when it does not fit.
+func (d Decimal) FloorToStep(step Decimal) Decimal {
+	if step.Sign() <= 0 {
+		return d
+	}
+	a, b, scale := alignBig(d, step)
+	// big.Int.Div is Euclidean, i.e. floor division for a positive divisor
+	q := new(big.Int).Div(a, b)
+	return saturate(q.Mul(q, b), scale)
+}
+
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), "\"")
+	if str == "" || str == "null" {
+		*d = Zero
+		return nil
+	}
+	v, err := Parse(str)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+func abs(v int64) uint64 {
+	if v < 0 {
+		return uint64(-v)
+	}
+	return uint64(v)
+}
+
+func bigPow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// align brings both coefficients to the larger scale without overflow.
+func align(a, b Decimal) (int64, int64, int32, bool) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	x, ok := rescale(a.coef, scale-a.scale)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	y, ok := rescale(b.coef, scale-b.scale)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return x, y, scale, true
+}
+
+func rescale(coef int64, k int32) (int64, bool) {
+	if k == 0 {
+		return coef, true
+	}
+	hi, lo := bits.Mul64(abs(coef), uint64(pow10[k]))
+	if hi != 0 || lo > math.MaxInt64 {
+		return 0, false
+	}
+	if coef < 0 {
+		return -int64(lo), true
+	}
+	return int64(lo), true
+}
+
+func alignBig(a, b Decimal) (*big.Int, *big.Int, int32) {
+	scale := a.scale
+	if b.scale > scale {
+		scale = b.scale
+	}
+	x := new(big.Int).Mul(big.NewInt(a.coef), bigPow10(scale-a.scale))
+	y := new(big.Int).Mul(big.NewInt(b.coef), bigPow10(scale-b.scale))
+	return x, y, scale
+}
+
+// fromBig truncates digits after the point until the value fits into the
+// representation; it returns ErrOverflow when the integer part itself does
+// not fit.
+func fromBig(v *big.Int, scale int32) (Decimal, error) {
+	ten := big.NewInt(10)
+	for scale > MaxScale || !v.IsInt64() {
+		if scale == 0 {
+			return Zero, ErrOverflow
+		}
+		v.Quo(v, ten)
+		scale--
+	}
+	return Decimal{coef: v.Int64(), scale: scale}, nil
+}
+
+// saturate is fromBig clamped to Max or Min on overflow.
+func saturate(v *big.Int, scale int32) Decimal {
+	d, err := fromBig(v, scale)
+	if err != nil {
+		if v.Sign() < 0 {
+			return Min
+		}
+		return Max
+	}
+	return d
+}
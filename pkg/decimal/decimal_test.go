@@ -0,0 +1,227 @@
+package decimal
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in     string
+		coef   int64
+		scale  int32
+		str    string
+		places int
+	}{
+		{"0.00000001", 1, 8, "0.00000001", 8},
+		{"10", 10, 0, "10", 0},
+		{"1e-8", 1, 8, "0.00000001", 8},
+		{"1E-8", 1, 8, "0.00000001", 8},
+		{"2.5e-3", 25, 4, "0.0025", 4},
+		{"1.5e3", 1500, 0, "1500", 0},
+		{"1e1", 10, 0, "10", 0},
+		{"0.01000000", 1000000, 8, "0.01000000", 2},
+		{"-12.340", -12340, 3, "-12.340", 2},
+		{"+0.5", 5, 1, "0.5", 1},
+		{".5", 5, 1, "0.5", 1},
+		{"5.", 5, 0, "5", 0},
+		{"0", 0, 0, "0", 0},
+		{"0.000", 0, 3, "0.000", 0},
+		{"0.1234567890123456789", 123456789012345678, 18, "0.123456789012345678", 18},
+	}
+
+	for _, tt := range tests {
+		d, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if d.coef != tt.coef || d.scale != tt.scale {
+			t.Errorf("Parse(%q) = %d * 10^-%d, want %d * 10^-%d", tt.in, d.coef, d.scale, tt.coef, tt.scale)
+		}
+		if got := d.String(); got != tt.str {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.str)
+		}
+		if got := d.Scale(); got != tt.places {
+			t.Errorf("Parse(%q).Scale() = %d, want %d", tt.in, got, tt.places)
+		}
+		// the string form parses back to the same value
+		if back := MustParse(d.String()); !back.Equal(d) {
+			t.Errorf("Parse(%q) does not round-trip: %s", tt.in, back)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", "-", ".", "abc", "1.2.3", "1e", "e5", "1e-", "1e+x", "0x10", "1e999", "99999999999999999999"} {
+		if d, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", in, d)
+		}
+	}
+}
+
+func TestFloorToStep(t *testing.T) {
+	tests := []struct {
+		value string
+		step  string
+		want  string
+	}{
+		{"0.123456789", "0.00000001", "0.12345678"},
+		{"0.00000001", "0.00000001", "0.00000001"},
+		{"0.000000009", "0.00000001", "0"},
+		{"1234.5", "10", "1230"},
+		{"1230", "10", "1230"},
+		{"9.99", "10", "0"},
+		{"1234.5", "0.5", "1234.5"},
+		{"1234.7", "0.5", "1234.5"},
+		{"1234.56", "0.01000000", "1234.56"},
+		{"-1234.5", "10", "-1240"},
+		{"1234.5", "0", "1234.5"},
+		{"1234.5", "-10", "1234.5"},
+	}
+
+	for _, tt := range tests {
+		got := MustParse(tt.value).FloorToStep(MustParse(tt.step))
+		if !got.Equal(MustParse(tt.want)) {
+			t.Errorf("%s.FloorToStep(%s) = %s, want %s", tt.value, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value  string
+		places int
+		want   string
+	}{
+		{"0.123456789", 8, "0.12345678"},
+		{"0.123456789", 0, "0"},
+		{"-1.999", 2, "-1.99"},
+		{"10", 8, "10"},
+		{"1.5", -1, "1"},
+		{"0.01000000", 2, "0.01"},
+	}
+
+	for _, tt := range tests {
+		got := MustParse(tt.value).Truncate(tt.places)
+		if got.String() != tt.want {
+			t.Errorf("%s.Truncate(%d) = %s, want %s", tt.value, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	// variables, so that the sum is not folded into an exact constant
+	a, b := 0.1, 0.2
+	tests := []struct {
+		value  float64
+		places int
+		want   string
+	}{
+		{a + b, 8, "0.3"},
+		{a + b, 17, "0.30000000000000004"},
+		{1e-8, 8, "0.00000001"},
+		{1234.5, 0, "1234"},
+		{-0.000123456789, 6, "-0.000123"},
+		{math.NaN(), 8, "0"},
+	}
+
+	for _, tt := range tests {
+		if got := FromFloat(tt.value).Truncate(tt.places); !got.Equal(MustParse(tt.want)) {
+			t.Errorf("FromFloat(%v).Truncate(%d) = %s, want %s", tt.value, tt.places, got, tt.want)
+		}
+	}
+
+	if got := FromFloat(math.Inf(1)); !got.Equal(Max) {
+		t.Errorf("FromFloat(+Inf) = %s, want Max", got)
+	}
+	if got := FromFloat(-1e30); !got.Equal(Min) {
+		t.Errorf("FromFloat(-1e30) = %s, want Min", got)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := MustParse("0.1"), MustParse("0.2")
+
+	sum, err := a.Add(b)
+	if err != nil || sum.String() != "0.3" {
+		t.Errorf("0.1 + 0.2 = %s, %v", sum, err)
+	}
+	diff, err := a.Sub(b)
+	if err != nil || diff.String() != "-0.1" {
+		t.Errorf("0.1 - 0.2 = %s, %v", diff, err)
+	}
+	prod, err := MustParse("1234.5").Mul(MustParse("0.00000001"))
+	if err != nil || !prod.Equal(MustParse("0.000012345")) {
+		t.Errorf("1234.5 * 0.00000001 = %s, %v", prod, err)
+	}
+	// digits past MaxScale are truncated instead of overflowing
+	prod, err = MustParse("0.000000001").Mul(MustParse("0.0000000001234"))
+	if err != nil || !prod.Equal(MustParse("0.000000000000000000")) {
+		t.Errorf("tiny product = %s, %v", prod, err)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	big := Decimal{coef: math.MaxInt64}
+
+	if _, err := big.Add(MustParse("1")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add: err = %v, want ErrOverflow", err)
+	}
+	if _, err := big.Neg().Sub(MustParse("10")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Sub: err = %v, want ErrOverflow", err)
+	}
+	if _, err := big.Mul(MustParse("2")); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul: err = %v, want ErrOverflow", err)
+	}
+	// a fraction is dropped before the integer part is found to overflow
+	if d, err := MustParse("9223372036854775807").Add(MustParse("0.5")); err != nil || !d.Equal(big) {
+		t.Errorf("Add with fraction = %s, %v", d, err)
+	}
+
+	if got := New(1, -30); !got.Equal(Max) {
+		t.Errorf("New(1, -30) = %s, want Max", got)
+	}
+	if got := New(-1, -30); !got.Equal(Min) {
+		t.Errorf("New(-1, -30) = %s, want Min", got)
+	}
+	if got := Min.FloorToStep(MustParse("10")); !got.Equal(Min) {
+		t.Errorf("Min.FloorToStep(10) = %s, want Min", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		coef  int64
+		scale int32
+		want  string
+	}{
+		{1, 8, "0.00000001"},
+		{1, 0, "1"},
+		{1, -1, "10"},
+		{15, 1, "1.5"},
+		{1, 20, "0.000000000000000000"},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.coef, tt.scale); !got.Equal(MustParse(tt.want)) {
+			t.Errorf("New(%d, %d) = %s, want %s", tt.coef, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	d := MustParse("0.01000000")
+	data, err := d.MarshalJSON()
+	if err != nil || string(data) != `"0.01000000"` {
+		t.Fatalf("MarshalJSON = %s, %v", data, err)
+	}
+	var back Decimal
+	if err := back.UnmarshalJSON(data); err != nil || !back.Equal(d) {
+		t.Errorf("UnmarshalJSON = %s, %v", back, err)
+	}
+	if err := back.UnmarshalJSON([]byte("null")); err != nil || !back.IsZero() {
+		t.Errorf("UnmarshalJSON(null) = %s, %v", back, err)
+	}
+}
@@ -1,7 +1,11 @@
 package websocket
 
 import (
+	"fmt"
+	"math/rand"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,19 +23,96 @@ type OnErrorHandler func(ws *WebSocketApp, err error)
 type OnCloseHandler func(ws *WebSocketApp)
 type OnPongHandler func(ws *WebSocketApp, pong string)
 type OnPingHandler func(ws *WebSocketApp, ping []byte)
+type OnStateChangeHandler func(ws *WebSocketApp, state ConnectionState)
+type OnHeartbeatHandler func(ws *WebSocketApp)
 
+// EndpointResolver returns the endpoint to dial, e.g. one carrying a fresh
+// connection token obtained over REST.
+type EndpointResolver func(ws *WebSocketApp) (string, error)
+
+// ConnectionState is the state of the connection owned by a WebSocketApp.
+type ConnectionState int
+
+const (
+	StateConnecting ConnectionState = iota
+	StateConnected
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ReconnectPolicy configures the exponential backoff between reconnection
+// attempts. MaxRetries of zero means retrying until the app is closed.
+type ReconnectPolicy struct {
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	MaxRetries int
+}
+
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MinDelay:   500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+	MaxRetries: 0,
+}
+
+// Delay returns the backoff before the given attempt (starting from 1) with
+// a random jitter over the upper half of the interval.
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	d := p.MinDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// WebSocketApp owns a connection: it reconnects with backoff whenever the
+// connection drops until Close is called. OnOpen is invoked on every
+// (re)connection and is the place to (re)send subscriptions. When Heartbeat is
+// set, OnHeartbeat is invoked at that interval to send application-level pings.
+// When Resolve is set, it is called before every dial instead of using the
+// endpoint given to Run; it may also adjust the Heartbeat of the connection.
+// LastMessage tells when anything, a pong included, was last received.
 type WebSocketApp struct {
-	OnOpen     OnOpenHandler
-	OnMessage  OnMessageHandler
-	OnError    OnErrorHandler
-	OnClose    OnCloseHandler
-	OnPong     OnPongHandler
-	OnPing     OnPingHandler
-	Config     *WsConfig
-	Connection *websocket.Conn
-	Stop       chan struct{}
-	Done       chan struct{}
-	IsRunning  bool
+	OnOpen        OnOpenHandler
+	OnMessage     OnMessageHandler
+	OnError       OnErrorHandler
+	OnClose       OnCloseHandler
+	OnPong        OnPongHandler
+	OnPing        OnPingHandler
+	OnStateChange OnStateChangeHandler
+	OnHeartbeat   OnHeartbeatHandler
+	Resolve       EndpointResolver
+	Heartbeat     time.Duration
+	Reconnect     *ReconnectPolicy
+	Config        *WsConfig
+	Connection    *websocket.Conn
+	Stop          chan struct{}
+	Done          chan struct{}
+	IsRunning     bool
+	state         ConnectionState
+	lock          sync.Mutex
+	stopOnce      sync.Once
+	lastMessage   atomic.Int64
 }
 
 func (ws *WebSocketApp) connect() (*websocket.Conn, error) {
@@ -42,17 +123,29 @@ func (ws *WebSocketApp) connect() (*websocket.Conn, error) {
 		EnableCompression: false,
 	}
 
+	if ws.Resolve != nil {
+		endpoint, err := ws.Resolve(ws)
+		if err != nil {
+			return nil, err
+		}
+		ws.Config.Endpoint = endpoint
+	}
+
 	c, _, err := Dialer.Dial(ws.Config.Endpoint, nil)
+	if err == nil {
+		ws.touch()
+	}
 
 	return c, err
 }
 
-func (ws *WebSocketApp) keepAlive() {
+func (ws *WebSocketApp) keepAlive(conn *websocket.Conn) {
 	ticker := time.NewTicker(ws.Config.Timeout)
 
 	lastResponse := time.Now()
-	ws.Connection.SetPongHandler(func(msg string) error {
+	conn.SetPongHandler(func(msg string) error {
 		lastResponse = time.Now()
+		ws.touch()
 		if ws.OnPong != nil {
 			ws.OnPong(ws, msg)
 		}
@@ -63,101 +156,260 @@ func (ws *WebSocketApp) keepAlive() {
 		defer ticker.Stop()
 		for {
 			deadline := time.Now().Add(10 * time.Second)
-			err := ws.Connection.WriteControl(websocket.PingMessage, []byte{}, deadline)
+			err := conn.WriteControl(websocket.PingMessage, []byte{}, deadline)
 			if err != nil {
 				return
 			}
 			<-ticker.C
 			if time.Since(lastResponse) > ws.Config.Timeout {
-				ws.Connection.Close()
+				conn.Close()
 				return
 			}
 		}
 	}()
 }
 
+func (ws *WebSocketApp) setState(state ConnectionState) {
+	ws.lock.Lock()
+	ws.state = state
+	ws.lock.Unlock()
+	if ws.OnStateChange != nil {
+		ws.OnStateChange(ws, state)
+	}
+}
+
+func (ws *WebSocketApp) State() ConnectionState {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.state
+}
+
+func (ws *WebSocketApp) touch() {
+	ws.lastMessage.Store(time.Now().UnixNano())
+}
+
+// LastMessage is the time of the last message or pong received, or of the
+// last (re)connection when nothing has been received since.
+func (ws *WebSocketApp) LastMessage() time.Time {
+	return time.Unix(0, ws.lastMessage.Load())
+}
+
+func (ws *WebSocketApp) stopped() bool {
+	select {
+	case <-ws.Stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run dials the endpoint and returns the dial error, if any. Afterwards the
+// connection is served and re-established in the background.
 func (ws *WebSocketApp) Run(endpoint string, keep_alive bool, timeout time.Duration) error {
 	ws.Config = NewWsConfig(endpoint, keep_alive, timeout)
+	ws.Stop = make(chan struct{})
+	ws.Done = make(chan struct{})
+
+	ws.setState(StateConnecting)
 	conn, err := ws.connect()
 	if err != nil {
+		close(ws.Done)
+		ws.setState(StateClosed)
 		return err
 	}
-	ws.Connection = conn
-	if ws.OnOpen != nil {
-		ws.OnOpen(ws)
-	}
-
-	ws.Connection.SetReadLimit(655350)
-	ws.Done = make(chan struct{})
-	ws.Stop = make(chan struct{})
 
 	ws.IsRunning = true
 
-	go func() {
-		// This function will exit either on error from
-		// websocket.Conn.ReadMessage or when the stopC channel is
-		// closed by the client.
-		defer close(ws.Done)
-		defer ws.Connection.Close()
-		if ws.OnClose != nil {
-			defer ws.OnClose(ws)
-		}
-		if ws.Config.WebsocketKeepalive {
-			ws.keepAlive()
+	go ws.loop(conn)
+
+	return nil
+}
+
+func (ws *WebSocketApp) loop(conn *websocket.Conn) {
+	defer close(ws.Done)
+	defer ws.setState(StateClosed)
+
+	policy := DefaultReconnectPolicy
+	if ws.Reconnect != nil {
+		policy = *ws.Reconnect
+	}
+
+	for {
+		ws.serve(conn)
+		if ws.stopped() {
+			return
 		}
-		// Wait for the stopC channel to be closed.  We do that in a
-		// separate goroutine because ReadMessage is a blocking
-		// operation.
-		silent := false
-		go func() {
+
+		ws.setState(StateReconnecting)
+		conn = nil
+		for attempt := 1; conn == nil; attempt++ {
+			if policy.MaxRetries > 0 && attempt > policy.MaxRetries {
+				ws.IsRunning = false
+				if ws.OnError != nil {
+					ws.OnError(ws, fmt.Errorf("websocket %s: giving up after %d reconnection attempts",
+						ws.Config.Endpoint, policy.MaxRetries))
+				}
+				return
+			}
+
 			select {
 			case <-ws.Stop:
-				silent = true
-				ws.Connection.Close()
-			case <-ws.Done:
+				return
+			case <-time.After(policy.Delay(attempt)):
 			}
-		}()
-		for {
-			op, message, err := ws.Connection.ReadMessage()
+
+			c, err := ws.connect()
 			if err != nil {
-				if !silent {
-					if ws.OnError != nil {
-						ws.OnError(ws, err)
-					}
+				if ws.OnError != nil {
+					ws.OnError(ws, err)
 				}
-				return
+				continue
 			}
+			conn = c
+		}
+	}
+}
 
-			if op == 9 {
-				if ws.OnPing != nil {
-					ws.OnPing(ws, message)
-				}
-			} else {
-				if ws.OnMessage != nil {
-					ws.OnMessage(ws, message)
+// serve reads the connection until it fails or the app is closed.
+func (ws *WebSocketApp) serve(conn *websocket.Conn) {
+	ws.lock.Lock()
+	ws.Connection = conn
+	ws.lock.Unlock()
+
+	conn.SetReadLimit(655350)
+	// server pings count as messages; the reply is what the default
+	// handler sends
+	conn.SetPingHandler(func(message string) error {
+		ws.touch()
+		err := conn.WriteControl(websocket.PongMessage, []byte(message), time.Now().Add(10*time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	ws.touch()
+	ws.setState(StateConnected)
+
+	finished := make(chan struct{})
+	defer close(finished)
+	defer conn.Close()
+	if ws.OnClose != nil {
+		defer ws.OnClose(ws)
+	}
+
+	// ReadMessage is a blocking operation, so the connection is closed
+	// from a separate goroutine when the app is stopped.
+	go func() {
+		select {
+		case <-ws.Stop:
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	if ws.OnOpen != nil {
+		ws.OnOpen(ws)
+	}
+	if ws.Config.WebsocketKeepalive {
+		ws.keepAlive(conn)
+	}
+	if ws.Heartbeat > 0 && ws.OnHeartbeat != nil {
+		go ws.heartbeat(finished)
+	}
+
+	for {
+		op, message, err := conn.ReadMessage()
+		if err != nil {
+			if !ws.stopped() {
+				if ws.OnError != nil {
+					ws.OnError(ws, err)
 				}
 			}
+			return
 		}
-	}()
+		ws.touch()
 
-	return nil
+		if op == 9 {
+			if ws.OnPing != nil {
+				ws.OnPing(ws, message)
+			}
+		} else {
+			if ws.OnMessage != nil {
+				ws.OnMessage(ws, message)
+			}
+		}
+	}
+}
+
+func (ws *WebSocketApp) heartbeat(finished chan struct{}) {
+	ticker := time.NewTicker(ws.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ticker.C:
+			ws.OnHeartbeat(ws)
+		}
+	}
+}
+
+// ForceReconnect drops the current connection; the app reconnects with
+// backoff and replays OnOpen as after any other connection loss.
+func (ws *WebSocketApp) ForceReconnect() {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.Connection != nil {
+		ws.Connection.Close()
+	}
 }
 
 func (ws *WebSocketApp) Send(message interface{}) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.Connection == nil {
+		return fmt.Errorf("websocket is not connected")
+	}
 	err := ws.Connection.WriteJSON(message)
 
 	return err
 }
 
+func (ws *WebSocketApp) SendText(message []byte) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.Connection == nil {
+		return fmt.Errorf("websocket is not connected")
+	}
+	err := ws.Connection.WriteMessage(websocket.TextMessage, message)
+
+	return err
+}
+
 func (ws *WebSocketApp) SendPong(pong []byte) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.Connection == nil {
+		return fmt.Errorf("websocket is not connected")
+	}
 	err := ws.Connection.WriteMessage(10, pong)
 
 	return err
 }
 
+// Close stops reconnecting, closes the connection and waits for the read
+// loop to exit. It is safe to call more than once and after the loop has
+// already given up.
 func (ws *WebSocketApp) Close() {
 	ws.IsRunning = false
-	ws.Stop <- struct{}{}
+	if ws.Stop == nil || ws.Done == nil {
+		return
+	}
+	ws.stopOnce.Do(func() { close(ws.Stop) })
 	<-ws.Done
 }
 